@@ -2,59 +2,128 @@ package main
 
 import (
 	"bytes"
+	"center/pkg/admin"
 	"center/pkg/api"
+	"center/pkg/config"
 	"center/pkg/db"
+	"center/pkg/interceptor"
+	"center/pkg/scim"
+	"center/pkg/tlsutil"
+	"context"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
-func init() {
-	// 初始化数据库
-	var err error
-	err = db.InitDB("./myapp.db")
+func main() {
+	// 单独执行表结构迁移
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// 加载配置
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// 初始化数据库
+	if err := db.InitDB(cfg); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
 	// 测试连接
-	if err := db.DB.CheckConnection(); err != nil {
+	if err := db.DB.CheckConnection(context.Background()); err != nil {
 		log.Fatalf("Database connection test failed: %v", err)
 	}
-}
 
-func main() {
-	targetBaseURL := "http://join-user-center:8084" // 目标服务地址
+	// 收到退出信号时停止接收请求和同步任务 worker
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 启动下游同步任务 worker
+	if err := api.StartSyncWorkers(ctx, cfg); err != nil {
+		log.Fatalf("Failed to start sync workers: %v", err)
+	}
+
+	// 注册拦截器
+	registry, err := interceptor.NewRegistry(api.Interceptors(cfg.Upstream.Response), cfg.Interceptors)
+	if err != nil {
+		log.Fatalf("Failed to register interceptors: %v", err)
+	}
+	for _, info := range registry.Active() {
+		log.Printf("Interceptor %s active on %s (%s)", info.Name, info.Route, info.Phase)
+	}
 
 	// 创建带连接池的HTTP客户端
+	transport, err := tlsutil.NewTransport(cfg.Upstream.TLS, func() *http.Transport {
+		return &http.Transport{
+			MaxIdleConns:       cfg.Upstream.MaxIdleConns,
+			IdleConnTimeout:    cfg.Upstream.IdleConnTimeout,
+			DisableCompression: cfg.Upstream.DisableCompression,
+		}
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure upstream TLS: %v", err)
+	}
 	client := &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:       100,
-			IdleConnTimeout:    90 * time.Second,
-			DisableCompression: false,
-		},
+		Timeout:   cfg.Upstream.Timeout,
+		Transport: transport,
 	}
 
-	http.HandleFunc("/", proxyHandler(targetBaseURL, client))
+	if cfg.SCIMServer.Enabled {
+		http.Handle(scim.PathPrefix+"/", scim.Handler(cfg.SCIMServer))
+		log.Printf("SCIM server enabled on %s/{appId}/Users and /Groups", scim.PathPrefix)
+	}
+	if cfg.Admin.Enabled {
+		http.Handle(admin.PathPrefix+"/", admin.Handler(cfg.Admin, api.Breakers()))
+		log.Printf("Admin API enabled on %s/status", admin.PathPrefix)
+	}
+	http.HandleFunc("/", proxyHandler(cfg.Upstream.BaseURL, client, registry))
 
 	// 启动服务器
 	server := &http.Server{
-		Addr:         ":8080",
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 20 * time.Second,
+		Addr:         cfg.Server.Listen,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
 	}
-	log.Println("Starting proxy server on :8080")
-	if err := server.ListenAndServe(); err != nil {
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		log.Printf("Shutting down, waiting up to %v for in-flight requests", cfg.Server.ShutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Server shutdown: %v", err)
+		}
+	}()
+	log.Printf("Starting proxy server on %s, upstream %s", cfg.Server.Listen, cfg.Upstream.BaseURL)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("Server error:", err)
 	}
+	// Shutdown 返回前 ListenAndServe 已返回，需等待进行中的请求完成
+	<-shutdown
+
+	// 等待 worker 退出，被中断的任务已写回 outbox，下次启动后重新执行
+	api.WaitSyncWorkers()
+	log.Printf("Proxy server stopped")
 }
 
-// proxyHandler returns an http.HandlerFunc that proxies requests to the targetBaseURL using the provided client.
-func proxyHandler(targetBaseURL string, client *http.Client) http.HandlerFunc {
+// proxyHandler returns an http.HandlerFunc that proxies requests to the targetBaseURL using the provided client,
+// running the matching interceptors from registry first.
+func proxyHandler(targetBaseURL string, client *http.Client, registry *interceptor.Registry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[%s] %s", r.Method, r.URL.Path)
 
@@ -72,7 +141,9 @@ func proxyHandler(targetBaseURL string, client *http.Client) http.HandlerFunc {
 		}
 		r.Body = io.NopCloser(bytes.NewBuffer(body))
 
-		if handled := handleSpecialCases(w, r, targetPath, body); handled {
+		matched := registry.Match(r, targetPath)
+		ex := &interceptor.Exchange{Request: r, Body: body, Values: make(map[string]any)}
+		if handled := runRequestInterceptors(w, matched, ex); handled {
 			return
 		}
 
@@ -84,6 +155,11 @@ func proxyHandler(targetBaseURL string, client *http.Client) http.HandlerFunc {
 
 		copyHeaders(req, r)
 		copyCookies(req, r)
+		responseInterceptors := filterResponseInterceptors(matched)
+		if len(responseInterceptors) > 0 {
+			// 响应拦截器需要读取明文响应体，交给 Transport 处理压缩
+			req.Header.Del("Accept-Encoding")
+		}
 
 		start := time.Now()
 		resp, err := client.Do(req)
@@ -95,30 +171,65 @@ func proxyHandler(targetBaseURL string, client *http.Client) http.HandlerFunc {
 		defer resp.Body.Close()
 		log.Printf("Forwarded to %s in %v", targetURL, time.Since(start))
 
+		if len(responseInterceptors) == 0 {
+			copyResponse(w, resp)
+			return
+		}
+
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil {
+			log.Printf("Failed to read backend response: %v", err)
+			http.Error(w, "Service unavailable", http.StatusBadGateway)
+			return
+		}
+		ex.StatusCode = resp.StatusCode
+		ex.Header = resp.Header
+		ex.ResponseBody = respBody
+		runResponseInterceptors(responseInterceptors, ex)
+		resp.Header = ex.Header
+		resp.Header.Set("Content-Length", strconv.Itoa(len(ex.ResponseBody)))
+		resp.Body = io.NopCloser(bytes.NewReader(ex.ResponseBody))
 		copyResponse(w, resp)
 	}
 }
 
-// handleSpecialCases processes special-case endpoints and returns true if the request was handled.
-func handleSpecialCases(w http.ResponseWriter, r *http.Request, targetPath string, body []byte) bool {
-	switch {
-	case targetPath == "/organization/user" && r.Method == http.MethodPost:
-		log.Println("Handling POST request to /organization/user")
-		if err := api.SyncUser(r, body); err != nil {
-			log.Printf("Error syncing user: %v", err)
-			http.Error(w, "Failed to sync user", http.StatusInternalServerError)
-			return true
+// runRequestInterceptors runs the request-phase interceptors and returns true if one of them failed
+// and an error response was written.
+func runRequestInterceptors(w http.ResponseWriter, matched []interceptor.Interceptor, ex *interceptor.Exchange) bool {
+	for _, ic := range matched {
+		ri, ok := ic.(interceptor.RequestInterceptor)
+		if !ok {
+			continue
 		}
-		return false
-	case targetPath == "/user/app/grant" && r.Method == http.MethodPost:
-		if err := api.GrantUsers(r, body); err != nil {
-			log.Printf("Error granting users: %v", err)
-			http.Error(w, "Failed to grant users", http.StatusInternalServerError)
+		log.Printf("Intercepting request %s %s with %s", ex.Request.Method, ex.Request.URL.Path, ri.Name())
+		if err := ri.InterceptRequest(ex); err != nil {
+			log.Printf("Interceptor %s failed: %v", ri.Name(), err)
+			http.Error(w, "Failed to process request: "+ri.Name(), http.StatusInternalServerError)
 			return true
 		}
-		return false
-	default:
-		return false
+	}
+	return false
+}
+
+// filterResponseInterceptors returns the matched interceptors that run after the upstream response.
+func filterResponseInterceptors(matched []interceptor.Interceptor) []interceptor.ResponseInterceptor {
+	var list []interceptor.ResponseInterceptor
+	for _, ic := range matched {
+		if ri, ok := ic.(interceptor.ResponseInterceptor); ok {
+			list = append(list, ri)
+		}
+	}
+	return list
+}
+
+// runResponseInterceptors runs the response-phase interceptors. The upstream has already applied the
+// change, so failures are logged and the upstream response is still returned to the client.
+func runResponseInterceptors(list []interceptor.ResponseInterceptor, ex *interceptor.Exchange) {
+	for _, ri := range list {
+		log.Printf("Intercepting response %s %s (%d) with %s", ex.Request.Method, ex.Request.URL.Path, ex.StatusCode, ri.Name())
+		if err := ri.InterceptResponse(ex); err != nil {
+			log.Printf("Interceptor %s failed: %v", ri.Name(), err)
+		}
 	}
 }
 
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"center/pkg/config"
+	"center/pkg/db"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `usage: main migrate <command> [flags]
+
+commands:
+  up      apply pending migrations (-to limits the target version)
+  down    revert applied migrations (-steps, default 1)
+  status  list migrations and whether they are applied
+  verify  check applied migrations against the migration files
+
+flags:`
+
+// runMigrate 执行 migrate 子命令，不启动服务
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	to := fs.Uint64("to", 0, "up: apply migrations up to this version (0 means all)")
+	steps := fs.Int("steps", 1, "down: number of migrations to revert")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing migrate command")
+	}
+	command := args[0]
+	// 只有 up 执行的数据迁移需要读取用户中心库，其他命令只校验状态库配置
+	cfg, err := config.LoadStateFlags(fs, args[1:], command == "up")
+	if err != nil {
+		return err
+	}
+
+	state, err := db.OpenState(cfg.State)
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := state.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	var jos *gorm.DB
+	if command == "up" {
+		if jos, err = db.OpenJos(cfg.Jos); err != nil {
+			return err
+		}
+		if sqlDB, err := jos.DB(); err == nil {
+			defer sqlDB.Close()
+		}
+	}
+	ctx := context.Background()
+	m, err := db.NewStateMigrator(state, jos)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		done, err := db.MigrateState(ctx, state, m, *to)
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied %d migrations", len(done))
+	case "down":
+		if *steps <= 0 {
+			return fmt.Errorf("-steps must be positive")
+		}
+		unlock, err := m.Lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		done, err := m.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		log.Printf("Reverted %d migrations", len(done))
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED\tPROBLEM")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, applied, s.Problem)
+		}
+		return w.Flush()
+	case "verify":
+		if err := m.Verify(ctx); err != nil {
+			return err
+		}
+		log.Printf("Applied migrations match the migration files")
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+	return nil
+}
@@ -1,22 +1,76 @@
 package model
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
-// JosApp 对应数据库表 jos_app
+// ProxyUserApp 用户在下游应用的映射，每个 (用户ID, 应用) 一条
 type ProxyUserApp struct {
-	ID         int64     `gorm:"column:id;primaryKey" json:"id"`
-	UserName   string    `gorm:"column:user_name;type:varchar(25)" json:"userName"` // 账号
-	Name       string    `gorm:"column:name;type:varchar(20);index" json:"name"`
-	Gender     int       `gorm:"column:gender" json:"gender"`
-	Mobile     string    `gorm:"column:mobile;type:varchar(255)" json:"mobile"`
-	Email      string    `gorm:"column:email;type:varchar(60)" json:"email"`
-	AppID      uint64    `gorm:"column:app_id;not null"`                                 // 应用ID
-	AppAddress string    `gorm:"column:app_address;type:varchar(255)" json:"appAddress"` // 应用地址
-	AppUserID  uint64    `gorm:"column:app_user_id"`                                     // 应用客户ID
-	CreateDate time.Time `gorm:"column:create_date;default:CURRENT_TIMESTAMP"`           // 创建时间（自动设置）
-	ModifyDate time.Time `gorm:"column:modify_date;autoUpdateTime"`                      // 修改时间（自动更新）
+	ID         int64  `gorm:"column:id;primaryKey" json:"id"`
+	UserID     uint64 `gorm:"column:user_id;index;uniqueIndex:idx_proxy_user_app_user_id_app,where:user_id <> 0" json:"userId"` // 用户中心用户ID，0 表示未知（按账号匹配的旧映射）
+	UserName   string `gorm:"column:user_name;type:varchar(25);index" json:"userName"`                                          // 账号
+	Name       string `gorm:"column:name;type:varchar(20);index" json:"name"`
+	Gender     int    `gorm:"column:gender" json:"gender"`
+	Mobile     string `gorm:"column:mobile;type:varchar(255)" json:"mobile"`
+	Email      string `gorm:"column:email;type:varchar(60)" json:"email"`
+	NickName   string `gorm:"column:nick_name;type:varchar(50)" json:"nickName"`
+	Code       string `gorm:"column:code;type:varchar(20)" json:"code"`
+	Avatar     string `gorm:"column:avatar;type:varchar(2000)" json:"avatar"`
+	Address    string `gorm:"column:address;type:varchar(200)" json:"address"`
+	TenantID   string `gorm:"column:tenant_id;type:varchar(255)" json:"tenantId"`
+	AppID      uint64 `gorm:"column:app_id;not null;uniqueIndex:idx_proxy_user_app_user_id_app"` // 应用ID
+	AppAddress string `gorm:"column:app_address;type:varchar(255)" json:"appAddress"`            // 应用地址
+	AppUserID  uint64 `gorm:"column:app_user_id"`                                                // 应用客户ID
+	AppUserRef string `gorm:"column:app_user_ref;type:varchar(255)" json:"appUserRef"`           // 下游账号ID原文（如 SCIM 资源 id）
+	DeleteMark int    `gorm:"column:delete_mark;not null;default:0" json:"deleteMark"`           // 1 表示已从下游应用移除
+	SyncState
+	CreateDate time.Time `gorm:"column:create_date;default:CURRENT_TIMESTAMP"` // 创建时间（自动设置）
+	ModifyDate time.Time `gorm:"column:modify_date;autoUpdateTime"`            // 修改时间（自动更新）
 }
 
+// Key returns the user the mapping belongs to.
+func (a ProxyUserApp) Key() UserKey {
+	return UserKey{ID: a.UserID, UserName: a.UserName}
+}
+
+// UserKey 映射所属的用户：按用户中心用户ID匹配，ID 为 0 时按账号匹配未知用户ID的旧映射
+type UserKey struct {
+	ID       uint64
+	UserName string
+}
+
+func (k UserKey) String() string {
+	if k.ID == 0 {
+		return k.UserName
+	}
+	return fmt.Sprintf("%s (#%d)", k.UserName, k.ID)
+}
+
+// 映射的移除标记
+const (
+	DeleteMarkRemoved  = 1 // 下游账号已删除（收回授权或删除用户）
+	DeleteMarkDisabled = 2 // 用户已禁用，重新启用时恢复开通
+)
+
+// SyncState 最近一次下游同步结果
+type SyncState struct {
+	SyncStatus    string    `gorm:"column:sync_status;type:varchar(20)" json:"status"`    // 同步状态
+	SyncCode      int       `gorm:"column:sync_code" json:"code"`                         // 下游返回码
+	SyncMessage   string    `gorm:"column:sync_message;type:varchar(255)" json:"message"` // 下游返回信息或错误
+	SyncLatencyMs int64     `gorm:"column:sync_latency_ms" json:"latencyMs"`              // 最近一次调用耗时（毫秒）
+	SyncAttempts  int       `gorm:"column:sync_attempts" json:"attempts"`                 // 已尝试次数
+	SyncDate      time.Time `gorm:"column:sync_date" json:"syncDate"`                     // 最近一次同步时间
+}
+
+// 同步结果状态
+const (
+	SyncStatusSuccess  = "success"  // 下游同步成功
+	SyncStatusRetrying = "retrying" // 失败，等待 outbox 重试
+	SyncStatusFailed   = "failed"   // 超过最大重试次数
+	SyncStatusSkipped  = "skipped"  // 应用未发布、未运行或无可用地址，未同步
+)
+
 func (ProxyUserApp) TableName() string {
 	return "proxy_user_app"
 }
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// 同步任务状态
+const (
+	SyncJobPending = "pending" // 等待执行（含等待重试）
+	SyncJobRunning = "running" // 执行中
+	SyncJobDone    = "done"    // 已完成
+	SyncJobDead    = "dead"    // 超过最大重试次数，进入死信
+	// 同一幂等键有更新的任务，不再执行
+	SyncJobSuperseded = "superseded"
+)
+
+// 同步任务操作类型
+const (
+	SyncOpCreate  = "create"
+	SyncOpUpdate  = "update"  // 更新已开通账号的资料
+	SyncOpDisable = "disable" // 禁用用户时停用下游账号
+	SyncOpDelete  = "delete"  // 删除用户或收回授权时删除下游账号
+)
+
+// SyncJob 下游应用用户同步任务（outbox），每个 (用户, 应用) 一条
+type SyncJob struct {
+	ID         uint64 `gorm:"column:id;primaryKey;autoIncrement" json:"id"`
+	UserID     uint64 `gorm:"column:user_id;index" json:"userId"`                          // 用户中心用户ID，0 表示未知
+	UserName   string `gorm:"column:user_name;type:varchar(25);index" json:"userName"`     // 账号
+	AppID      uint64 `gorm:"column:app_id;not null;index" json:"appId"`                   // 应用ID
+	AppAddress string `gorm:"column:app_address;type:varchar(255)" json:"appAddress"`      // 应用地址
+	Operation  string `gorm:"column:operation;type:varchar(20);not null" json:"operation"` // 操作类型
+	// 幂等键，同一 (用户, 应用) 相同，见 SyncJobKey
+	IdempotencyKey string    `gorm:"column:idempotency_key;type:varchar(255);index" json:"idempotencyKey"`
+	Payload        string    `gorm:"column:payload;type:text" json:"payload"`                        // 下游请求体JSON
+	Status         string    `gorm:"column:status;type:varchar(20);not null;index" json:"status"`    // 任务状态
+	Attempts       int       `gorm:"column:attempts;not null;default:0" json:"attempts"`             // 已执行次数
+	MaxAttempts    int       `gorm:"column:max_attempts;not null" json:"maxAttempts"`                // 最大执行次数
+	NextRunAt      time.Time `gorm:"column:next_run_at;index" json:"nextRunAt"`                      // 下次执行时间
+	LastError      string    `gorm:"column:last_error;type:text" json:"lastError"`                   // 最近一次错误
+	LastCode       int       `gorm:"column:last_code" json:"lastCode"`                               // 最近一次下游返回码
+	LastMessage    string    `gorm:"column:last_message;type:varchar(255)" json:"lastMessage"`       // 最近一次下游返回信息
+	LatencyMs      int64     `gorm:"column:latency_ms" json:"latencyMs"`                             // 最近一次执行耗时（毫秒）
+	CreateDate     time.Time `gorm:"column:create_date;default:CURRENT_TIMESTAMP" json:"createDate"` // 创建时间（自动设置）
+	ModifyDate     time.Time `gorm:"column:modify_date;autoUpdateTime" json:"modifyDate"`            // 修改时间（自动更新）
+}
+
+// SyncJobKey returns the idempotency key of the jobs on a user-app mapping,
+// built from the user ID when known so that it survives a rename. It is
+// deliberately coarser than (user, app, operation): a revoke followed by a
+// regrant must supersede each other, and a create must never run alongside a
+// delete of the same account, so the outbox supersedes and serializes jobs per
+// mapping. The key sent downstream adds the operation and the job ID.
+func SyncJobKey(user UserKey, appID uint64) string {
+	if user.ID != 0 {
+		// 账号经 PathEscape 后不含 #，两种键不会冲突
+		return fmt.Sprintf("#%d:%d", user.ID, appID)
+	}
+	return fmt.Sprintf("%s:%d", url.PathEscape(user.UserName), appID)
+}
+
+// UserKey returns the user the job belongs to.
+func (j *SyncJob) UserKey() UserKey {
+	return UserKey{ID: j.UserID, UserName: j.UserName}
+}
+
+// SyncState converts the job outcome into the sync state stored on the user-app mapping.
+func (j *SyncJob) SyncState() SyncState {
+	state := SyncState{
+		SyncCode:      j.LastCode,
+		SyncMessage:   j.LastMessage,
+		SyncLatencyMs: j.LatencyMs,
+		SyncAttempts:  j.Attempts,
+		SyncDate:      time.Now(),
+	}
+	switch j.Status {
+	case SyncJobDone:
+		state.SyncStatus = SyncStatusSuccess
+	case SyncJobDead:
+		state.SyncStatus = SyncStatusFailed
+	default:
+		state.SyncStatus = SyncStatusRetrying
+	}
+	if state.SyncMessage == "" {
+		state.SyncMessage = j.LastError
+	}
+	if msg := []rune(state.SyncMessage); len(msg) > 255 {
+		state.SyncMessage = string(msg[:255])
+	}
+	return state
+}
+
+func (SyncJob) TableName() string {
+	return "proxy_sync_job"
+}
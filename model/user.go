@@ -31,3 +31,8 @@ type XjrUser struct {
 func (XjrUser) TableName() string {
 	return "xjr_user"
 }
+
+// Key returns the key of the user's proxy mappings.
+func (u XjrUser) Key() UserKey {
+	return UserKey{ID: uint64(u.ID), UserName: u.UserName}
+}
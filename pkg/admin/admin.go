@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"center/pkg/breaker"
+	"center/pkg/config"
+	"center/pkg/db"
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// PathPrefix 管理接口路径前缀
+const PathPrefix = "/_proxy"
+
+// Status 代理运行状态
+type Status struct {
+	Breakers []breaker.Status `json:"breakers"` // 已调用过的下游应用的熔断和健康状态
+	Outbox   map[string]int64 `json:"outbox"`   // 各状态的同步任务数
+}
+
+// Handler returns the admin API, served under PathPrefix:
+// GET /_proxy/status reports the downstream breakers and the outbox backlog.
+func Handler(cfg config.AdminConfig, breakers *breaker.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PathPrefix+"/status", func(w http.ResponseWriter, r *http.Request) {
+		counts, err := db.DB.CountSyncJobsByStatus(r.Context())
+		if err != nil {
+			log.Printf("Failed to get outbox status: %v", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, Status{Breakers: breakers.Snapshot(), Outbox: counts})
+	})
+	return authenticate(cfg.BearerToken, mux)
+}
+
+// authenticate 校验 Bearer Token
+func authenticate(bearerToken string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(bearerToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "authorization required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write admin response: %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"center/model"
+	"center/pkg/breaker"
+	"center/pkg/config"
+	"center/pkg/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupDB(t *testing.T) {
+	t.Helper()
+	state, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "state.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.NewStateMigrator(state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MigrateState(context.Background(), state, m, 0); err != nil {
+		t.Fatal(err)
+	}
+	orig := db.DB
+	db.DB = db.Database{StateDb: state}
+	t.Cleanup(func() { db.DB = orig })
+}
+
+func TestStatus(t *testing.T) {
+	setupDB(t)
+	var jobs []model.SyncJob
+	for _, status := range []string{model.SyncJobPending, model.SyncJobPending, model.SyncJobDead} {
+		jobs = append(jobs, model.SyncJob{AppID: 10, Operation: model.SyncOpCreate, Status: status, MaxAttempts: 3, NextRunAt: time.Now()})
+	}
+	if err := db.DB.CreateSyncJobs(context.Background(), jobs); err != nil {
+		t.Fatal(err)
+	}
+	breakers := breaker.NewRegistry(config.BreakerConfig{Enabled: true, FailureThreshold: 1, Cooldown: time.Minute, HalfOpenProbes: 1})
+	breakers.Record(10, "http://app", errors.New("connection refused"))
+	h := Handler(config.AdminConfig{Enabled: true, BearerToken: "token"}, breakers)
+
+	for _, auth := range []string{"", "Bearer wrong", "token"} {
+		req := httptest.NewRequest(http.MethodGet, PathPrefix+"/status", nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("status with Authorization %q = %d, want 401", auth, rec.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, PathPrefix+"/status", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var status Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Outbox[model.SyncJobPending] != 2 || status.Outbox[model.SyncJobDead] != 1 {
+		t.Errorf("outbox = %v", status.Outbox)
+	}
+	if len(status.Breakers) != 1 || status.Breakers[0].AppID != 10 || status.Breakers[0].State != breaker.StateOpen {
+		t.Errorf("breakers = %+v", status.Breakers)
+	}
+}
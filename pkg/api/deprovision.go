@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bytes"
+	"center/model"
+	"center/pkg/db"
+	"center/pkg/interceptor"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// UserEnabledRequest 用户中心启用/禁用用户的请求体
+type UserEnabledRequest struct {
+	ID          string `json:"id"`
+	EnabledMark int    `json:"enabledMark"`
+}
+
+// 请求阶段解析出的待移除账号，在 Exchange.Values 中传递给响应阶段
+const deprovisionUsersKey = "deprovisionUsers"
+
+// ResolveDeletedUsers records the accounts of the users about to be deleted, as
+// the user center may no longer return them once the delete is applied.
+func ResolveDeletedUsers(ex *interceptor.Exchange) error {
+	ids, err := parseUserIDs(ex)
+	if err != nil {
+		log.Printf("Cannot determine deleted users, skipping deprovision: %v", err)
+		return nil
+	}
+	ex.Values[deprovisionUsersKey] = lookupUsers(ex.Request.Context(), ids)
+	return nil
+}
+
+// ResolveDisabledUser records the account of the user about to be disabled.
+func ResolveDisabledUser(ex *interceptor.Exchange) error {
+	var req UserEnabledRequest
+	if err := json.Unmarshal(ex.Body, &req); err != nil {
+		log.Printf("Cannot parse enabled request, skipping deprovision: %v", err)
+		return nil
+	}
+	if req.EnabledMark != 0 {
+		return nil
+	}
+	id, err := strconv.ParseUint(req.ID, 10, 64)
+	if err != nil {
+		log.Printf("Invalid user ID %s, skipping deprovision: %v", req.ID, err)
+		return nil
+	}
+	ex.Values[deprovisionUsersKey] = lookupUsers(ex.Request.Context(), []uint64{id})
+	return nil
+}
+
+// EnableUser restores the accounts a disable deactivated once the user center
+// has accepted the re-enable: accounts that still exist are updated, which
+// reactivates them, and accounts the app deleted instead are created again.
+func EnableUser(ex *interceptor.Exchange) error {
+	var req UserEnabledRequest
+	if err := json.Unmarshal(ex.Body, &req); err != nil {
+		log.Printf("Cannot parse enabled request, skipping reprovision: %v", err)
+		return nil
+	}
+	if req.EnabledMark == 0 {
+		return nil
+	}
+	if _, ok := acceptedByUpstream(ex); !ok {
+		log.Printf("User center rejected enabling user %s (status %d), skipping reprovision", req.ID, ex.StatusCode)
+		return nil
+	}
+	id, err := strconv.ParseUint(req.ID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid user ID %s: %w", req.ID, err)
+	}
+
+	ctx := ex.Request.Context()
+	user, err := db.DB.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	apps, err := db.DB.GetDisabledProxyUserApps(ctx, user.Key())
+	if err != nil {
+		return err
+	}
+	if len(apps) == 0 {
+		return nil
+	}
+	for i := range apps {
+		setProfile(&apps[i], user)
+	}
+	// 合并时恢复移除标记，保留停用账号的ID，创建任务据此更新或重新创建下游账号
+	jobs, err := handleSync(ctx, apps)
+	if err != nil {
+		return fmt.Errorf("failed to dispatch reprovision: %w", err)
+	}
+	reportSyncResults(ex, jobs, nil)
+	return nil
+}
+
+// DeleteUsers deletes the recorded users' accounts in every app they were
+// provisioned to, once the user center has accepted the delete, including the
+// accounts deactivated by an earlier disable.
+func DeleteUsers(ex *interceptor.Exchange) error {
+	return deprovisionUsers(ex, model.SyncOpDelete)
+}
+
+// DisableUsers disables the recorded users' accounts in every app they were
+// provisioned to, once the user center has accepted the disable.
+func DisableUsers(ex *interceptor.Exchange) error {
+	return deprovisionUsers(ex, model.SyncOpDisable)
+}
+
+func deprovisionUsers(ex *interceptor.Exchange, operation string) error {
+	users, _ := ex.Values[deprovisionUsersKey].([]model.UserKey)
+	if len(users) == 0 {
+		return nil
+	}
+	if _, ok := acceptedByUpstream(ex); !ok {
+		log.Printf("User center rejected %s %s (status %d), skipping deprovision", ex.Request.Method, ex.Request.URL.Path, ex.StatusCode)
+		return nil
+	}
+
+	ctx := ex.Request.Context()
+	var jobs []model.SyncJob
+	for _, user := range users {
+		// 删除时也移除之前禁用时停用的账号
+		getApps := db.DB.GetProxyUserApps
+		if operation == model.SyncOpDelete {
+			getApps = db.DB.GetUnremovedProxyUserApps
+		}
+		apps, err := getApps(ctx, user)
+		if err != nil {
+			return err
+		}
+		for _, app := range apps {
+			job, err := newSyncJob(app, operation, syncPayload{RemoteID: remoteIDOf(app)})
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	jobs, err := syncPool.Dispatch(ctx, jobs)
+	if err != nil {
+		return fmt.Errorf("failed to dispatch deprovision: %w", err)
+	}
+	reportSyncResults(ex, jobs, nil)
+	return nil
+}
+
+// parseUserIDs 从请求体（ID数组，或包含 ids/id 的对象）或查询参数 ids/id 中解析用户ID
+func parseUserIDs(ex *interceptor.Exchange) ([]uint64, error) {
+	var raw []json.RawMessage
+	body := bytes.TrimSpace(ex.Body)
+	switch {
+	case len(body) > 0 && body[0] == '[':
+		if err := json.Unmarshal(body, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+	case len(body) > 0 && body[0] == '{':
+		var obj struct {
+			IDs []json.RawMessage `json:"ids"`
+			ID  json.RawMessage   `json:"id"`
+		}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		raw = obj.IDs
+		if obj.ID != nil {
+			raw = append(raw, obj.ID)
+		}
+	default:
+		query := ex.Request.URL.Query()
+		for _, key := range []string{"ids", "id"} {
+			for _, value := range query[key] {
+				for _, id := range strings.Split(value, ",") {
+					raw = append(raw, json.RawMessage(strconv.Quote(strings.TrimSpace(id))))
+				}
+			}
+		}
+	}
+
+	ids := make([]uint64, 0, len(raw))
+	for _, r := range raw {
+		id, ok := parseID(r)
+		if !ok {
+			return nil, fmt.Errorf("invalid user ID %s", r)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no user ID in request")
+	}
+	return ids, nil
+}
+
+// lookupUsers 查询用户账号，查询失败的用户记录日志后跳过
+func lookupUsers(ctx context.Context, ids []uint64) []model.UserKey {
+	var users []model.UserKey
+	for _, id := range ids {
+		user, err := db.DB.GetUserByID(ctx, id)
+		if err != nil {
+			log.Printf("Skipping deprovision of user %d: %v", id, err)
+			continue
+		}
+		users = append(users, user.Key())
+	}
+	return users
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"center/model"
+	"center/pkg/db"
+	"center/pkg/interceptor"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// acceptedExchange 用户中心已接受的请求，deprovisionUsersKey 为待移除的用户
+func acceptedExchange(users ...model.UserKey) *interceptor.Exchange {
+	return &interceptor.Exchange{
+		Request:      httptest.NewRequest(http.MethodPost, "/user", nil),
+		StatusCode:   http.StatusOK,
+		Header:       http.Header{},
+		ResponseBody: []byte(`{"code":0}`),
+		Values:       map[string]any{deprovisionUsersKey: users},
+	}
+}
+
+func TestDeleteDisabledUser(t *testing.T) {
+	ctx := context.Background()
+	setupSync(t)
+	alice := model.UserKey{ID: 1, UserName: "alice"}
+	if _, err := db.DB.MergeProxyUserApps(ctx, db.ProxyUserAppMerge{User: alice, Upsert: []model.ProxyUserApp{{AppID: 10}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.SetProxyUserAppRemoteID(ctx, alice, 10, "remote"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DisableUsers(acceptedExchange(alice)); err != nil {
+		t.Fatal(err)
+	}
+	// 禁用后删除用户时删除停用的下游账号
+	if err := DeleteUsers(acceptedExchange(alice)); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"disable remote", "delete remote"}; !slices.Equal(stub.calls, want) {
+		t.Errorf("downstream calls = %v, want %v", stub.calls, want)
+	}
+	apps, err := db.DB.GetUnremovedProxyUserApps(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 0 {
+		t.Errorf("mappings left after delete = %+v", apps)
+	}
+}
+
+func TestRevokeFromDisabledUser(t *testing.T) {
+	ctx := context.Background()
+	setupSync(t)
+	alice := model.UserKey{ID: 1, UserName: "alice"}
+	if _, err := db.DB.MergeProxyUserApps(ctx, db.ProxyUserAppMerge{User: alice, Upsert: []model.ProxyUserApp{{AppID: 10}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.SetProxyUserAppRemoteID(ctx, alice, 10, "remote"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DisableUsers(acceptedExchange(alice)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 下游删除失败留待重试时，映射同样不再恢复
+	stub.failDelete = errors.New("unavailable")
+	ex := acceptedExchange()
+	ex.Request.Header.Set("Content-Type", contentTypeJSON)
+	ex.Body = []byte(`{"appIdList":["5"],"userIdList":["1"]}`)
+	if err := RevokeUsers(ex); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"disable remote", "delete remote"}; !slices.Equal(stub.calls, want) {
+		t.Errorf("downstream calls = %v, want %v", stub.calls, want)
+	}
+	// 收回的应用在重新启用时不再恢复
+	apps, err := db.DB.GetDisabledProxyUserApps(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 0 {
+		t.Errorf("disabled mappings left after revoke = %+v", apps)
+	}
+}
@@ -3,9 +3,13 @@ package api
 import (
 	"center/model"
 	"center/pkg/db"
+	"center/pkg/endpoint"
+	"center/pkg/interceptor"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"log"
 	"strconv"
 	"strings"
 )
@@ -16,74 +20,187 @@ type GrantRequest struct {
 	SyncFlag   int      `json:"syncFlag"`   // 同步标志
 }
 
-func GrantUsers(r *http.Request, body []byte) error {
+// GrantUsers provisions the granted users to the apps once the user center has
+// accepted the grant.
+func GrantUsers(ex *interceptor.Exchange) error {
 	// 检查Content-Type
-	if !strings.Contains(r.Header.Get("Content-Type"), contentTypeJSON) {
+	if !strings.Contains(ex.Request.Header.Get("Content-Type"), contentTypeJSON) {
 		return fmt.Errorf("Content-Type must be %s", contentTypeJSON)
 	}
 
 	// 解析JSON到结构体
 	var req GrantRequest
-	if err := json.Unmarshal(body, &req); err != nil {
+	if err := json.Unmarshal(ex.Body, &req); err != nil {
 		return fmt.Errorf("grantUsers failed to parse JSON: %w", err)
 	}
 
+	// 用户中心拒绝时不同步
+	if _, ok := acceptedByUpstream(ex); !ok {
+		log.Printf("User center rejected grant (status %d), skipping sync", ex.StatusCode)
+		return nil
+	}
+
 	// 处理同步逻辑
-	return buildGrantUserApps(req)
+	ctx := ex.Request.Context()
+	userApps, skipped, err := buildGrantUserApps(ctx, req)
+	if err != nil {
+		return err
+	}
+	jobs, err := handleSync(ctx, userApps)
+	if err != nil {
+		return fmt.Errorf("failed to handle sync: %w", err)
+	}
+	reportSyncResults(ex, jobs, skipped)
+	return nil
 }
 
-// buildGrantUserApps processes the user and app lists and returns the userApps slice or an error.
-func buildGrantUserApps(req GrantRequest) error {
+// buildGrantUserApps processes the user and app lists and returns the userApps
+// slice and the apps skipped for each user, or an error.
+func buildGrantUserApps(ctx context.Context, req GrantRequest) ([]model.ProxyUserApp, []SyncResult, error) {
+	var all []model.ProxyUserApp
+	var skipped []SyncResult
 	for _, userID := range req.UserIdList {
 		id, err := strconv.ParseUint(userID, 10, 64)
 		if err != nil {
-			return fmt.Errorf("invalid user ID %s: %w", userID, err)
+			return nil, nil, fmt.Errorf("invalid user ID %s: %w", userID, err)
 		}
-		user, err := db.DB.GetUserByID(id)
+		user, err := db.DB.GetUserByID(ctx, id)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
-		userApps, err := buildAppsForUser(user, req.AppIdList)
+		userApps, userSkipped, err := buildAppsForUser(ctx, user, req.AppIdList)
 		if err != nil {
-			return err
-		}
-		err = handleSync(userApps)
-		if err != nil {
-			return fmt.Errorf("failed to handle sync for user %s: %w", user.UserName, err)
+			return nil, nil, fmt.Errorf("failed to build apps for user %s: %w", user.UserName, err)
 		}
+		all = append(all, userApps...)
+		skipped = append(skipped, userSkipped...)
 	}
-	return nil
+	return all, skipped, nil
 }
 
-// buildAppsForUser builds ProxyUserApp entries for a user and a list of app IDs.
-func buildAppsForUser(user model.XjrUser, appIdList []string) ([]model.ProxyUserApp, error) {
+// buildAppsForUser builds ProxyUserApp entries for a user and a list of app IDs,
+// resolving each app's sync URL. Apps that cannot be synced are returned as
+// skipped results with the reason instead of failing the request.
+func buildAppsForUser(ctx context.Context, user model.XjrUser, appIdList []string) ([]model.ProxyUserApp, []SyncResult, error) {
 	var proxyUserApps []model.ProxyUserApp
+	var skipped []SyncResult
 	for _, appIDStr := range appIdList {
 		id, err := strconv.ParseUint(appIDStr, 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("invalid app ID %s: %w", appIDStr, err)
+			return nil, nil, fmt.Errorf("invalid app ID %s: %w", appIDStr, err)
 		}
 
-		// 获取应用的发布地址
-		publishAddressInside, err := getAddressesByID(id)
+		app, err := db.DB.GetJosAppByID(ctx, id)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get publish address for app ID %d: %w", id, err)
+			return nil, nil, err
+		}
+		// 解析同步地址，应用未发布或无可用地址时跳过
+		address, err := endpoints.Resolve(ctx, app)
+		var skip *endpoint.SkipError
+		if errors.As(err, &skip) {
+			log.Printf("Skipping sync of %s to app %d: %s", user.UserName, skip.AppID, skip.Reason)
+			skipped = append(skipped, skippedResult(user.UserName, skip))
+			continue
 		}
-		// 获取app_id
-		appID, err := db.DB.GetJosAppIDByID(id)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get app ID for id %d: %w", id, err)
+			return nil, nil, err
 		}
-		// 将用户信息和应用发布地址同步到sqlite数据库
+		// 将用户信息和应用同步地址同步到状态库
 		var proxyUserApp model.ProxyUserApp
-		proxyUserApp.UserName = user.UserName
-		proxyUserApp.Name = user.Name
-		proxyUserApp.Mobile = user.Mobile
-		proxyUserApp.Email = user.Email
-		proxyUserApp.AppID = appID
-		proxyUserApp.AppAddress = publishAddressInside
+		setProfile(&proxyUserApp, user)
+		proxyUserApp.AppID = app.AppID
+		proxyUserApp.AppAddress = address
 
 		proxyUserApps = append(proxyUserApps, proxyUserApp)
 	}
-	return proxyUserApps, nil
+	return proxyUserApps, skipped, nil
+}
+
+// RevokeUsers removes the users from the named apps once the user center has
+// accepted the revoke. Mappings for the users' other apps are left untouched.
+func RevokeUsers(ex *interceptor.Exchange) error {
+	// 检查Content-Type
+	if !strings.Contains(ex.Request.Header.Get("Content-Type"), contentTypeJSON) {
+		return fmt.Errorf("Content-Type must be %s", contentTypeJSON)
+	}
+
+	// 解析JSON到结构体
+	var req GrantRequest
+	if err := json.Unmarshal(ex.Body, &req); err != nil {
+		return fmt.Errorf("revokeUsers failed to parse JSON: %w", err)
+	}
+
+	// 用户中心拒绝时不移除
+	if _, ok := acceptedByUpstream(ex); !ok {
+		log.Printf("User center rejected revoke (status %d), skipping deprovision", ex.StatusCode)
+		return nil
+	}
+
+	ctx := ex.Request.Context()
+	jobs, disabled, err := buildRevokeJobs(ctx, req)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+	jobs, err = syncPool.Dispatch(ctx, jobs)
+	if err != nil {
+		return fmt.Errorf("failed to dispatch revoke: %w", err)
+	}
+	// 停用的映射立即标记为已移除，重新启用用户时不再恢复被收回的应用
+	for _, app := range disabled {
+		if err := db.DB.MarkProxyUserAppRemoved(context.WithoutCancel(ctx), app.Key(), app.AppID); err != nil {
+			return err
+		}
+	}
+	reportSyncResults(ex, jobs, nil)
+	return nil
+}
+
+// buildRevokeJobs builds a delete job for every existing mapping of the
+// requested users on the requested apps, and returns the mappings among them
+// that a disable deactivated.
+func buildRevokeJobs(ctx context.Context, req GrantRequest) ([]model.SyncJob, []model.ProxyUserApp, error) {
+	appIDs := make([]uint64, 0, len(req.AppIdList))
+	for _, appIDStr := range req.AppIdList {
+		id, err := strconv.ParseUint(appIDStr, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid app ID %s: %w", appIDStr, err)
+		}
+		// 映射中保存的是 jos_app.app_id
+		appID, err := db.DB.GetJosAppIDByID(ctx, id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get app ID for id %d: %w", id, err)
+		}
+		appIDs = append(appIDs, appID)
+	}
+
+	var jobs []model.SyncJob
+	var disabled []model.ProxyUserApp
+	for _, userID := range req.UserIdList {
+		id, err := strconv.ParseUint(userID, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid user ID %s: %w", userID, err)
+		}
+		user, err := db.DB.GetUserByID(ctx, id)
+		if err != nil {
+			return nil, nil, err
+		}
+		apps, err := db.DB.GetProxyUserAppsByAppIDs(ctx, user.Key(), appIDs)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, app := range apps {
+			job, err := newSyncJob(app, model.SyncOpDelete, syncPayload{RemoteID: remoteIDOf(app)})
+			if err != nil {
+				return nil, nil, err
+			}
+			jobs = append(jobs, job)
+			if app.DeleteMark == model.DeleteMarkDisabled {
+				disabled = append(disabled, app)
+			}
+		}
+	}
+	return jobs, disabled, nil
 }
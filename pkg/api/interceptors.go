@@ -0,0 +1,49 @@
+package api
+
+import (
+	"center/pkg/config"
+	"center/pkg/interceptor"
+	"net/http"
+)
+
+// Interceptors returns every user-center interceptor provided by this package.
+// They read the user center responses with the envelope described by cfg.
+func Interceptors(cfg config.UpstreamResponseConfig) []interceptor.Interceptor {
+	upstreamResponse = cfg
+	return []interceptor.Interceptor{
+		interceptor.NewResponse("sync-user", interceptor.Route{
+			Method:      http.MethodPost,
+			Path:        "/organization/user",
+			ContentType: contentTypeJSON,
+		}, SyncUser),
+		interceptor.NewResponse("update-user-profile", interceptor.Route{
+			Method:      http.MethodPut,
+			Path:        "/organization/user",
+			ContentType: contentTypeJSON,
+		}, UpdateUserProfile),
+		interceptor.NewResponse("grant-users", interceptor.Route{
+			Method:      http.MethodPost,
+			Path:        "/user/app/grant",
+			ContentType: contentTypeJSON,
+		}, GrantUsers),
+		interceptor.NewResponse("revoke-users", interceptor.Route{
+			Method:      http.MethodPost,
+			Path:        "/user/app/revoke",
+			ContentType: contentTypeJSON,
+		}, RevokeUsers),
+		interceptor.NewTwoPhase("deprovision-deleted-users", interceptor.Route{
+			Method: http.MethodDelete,
+			Path:   "/organization/user",
+		}, ResolveDeletedUsers, DeleteUsers),
+		interceptor.NewTwoPhase("deprovision-disabled-users", interceptor.Route{
+			Method:      http.MethodPut,
+			Path:        "/organization/user/enabled",
+			ContentType: contentTypeJSON,
+		}, ResolveDisabledUser, DisableUsers),
+		interceptor.NewResponse("reprovision-enabled-user", interceptor.Route{
+			Method:      http.MethodPut,
+			Path:        "/organization/user/enabled",
+			ContentType: contentTypeJSON,
+		}, EnableUser),
+	}
+}
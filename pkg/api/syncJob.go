@@ -0,0 +1,340 @@
+package api
+
+import (
+	"center/model"
+	"center/pkg/breaker"
+	"center/pkg/config"
+	"center/pkg/connector"
+	"center/pkg/db"
+	"center/pkg/endpoint"
+	"center/pkg/interceptor"
+	"center/pkg/outbox"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+// 下游同步任务队列、各应用的熔断器和同步地址解析，由 StartSyncWorkers 初始化
+var (
+	syncPool  *outbox.Pool
+	breakers  *breaker.Registry
+	endpoints *endpoint.Resolver
+)
+
+// StartSyncWorkers starts the outbox workers that deliver queued user syncs to
+// the downstream apps until ctx is cancelled.
+func StartSyncWorkers(ctx context.Context, cfg *config.Config) error {
+	if err := connector.Init(cfg.Downstream, cfg.Apps); err != nil {
+		return fmt.Errorf("invalid app configuration: %w", err)
+	}
+	resolver, err := endpoint.NewResolver(cfg.Endpoints, cfg.Apps)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint configuration: %w", err)
+	}
+	endpoints = resolver
+	breakers = breaker.NewRegistry(cfg.Breaker)
+	syncPool = outbox.NewPool(cfg.Outbox, executeSyncJob, recordSyncResult)
+	if err := syncPool.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start sync workers: %w", err)
+	}
+	return nil
+}
+
+// WaitSyncWorkers blocks until the workers started by StartSyncWorkers have
+// stopped. Jobs interrupted by the cancellation are saved back to the outbox.
+func WaitSyncWorkers() {
+	if syncPool != nil {
+		syncPool.Wait()
+	}
+}
+
+// Breakers returns the per-app circuit breakers used by the sync workers.
+func Breakers() *breaker.Registry {
+	return breakers
+}
+
+// syncPayload 同步任务的请求数据，RemoteID 为已开通的下游账号ID
+type syncPayload struct {
+	User     connector.User `json:"user"`
+	RemoteID string         `json:"remoteId,omitempty"`
+}
+
+// userOf 映射中保存的用户资料
+func userOf(app model.ProxyUserApp) connector.User {
+	return connector.User{
+		UserName: app.UserName,
+		Name:     app.Name,
+		Mobile:   app.Mobile,
+		Email:    app.Email,
+		Gender:   app.Gender,
+		NickName: app.NickName,
+		Code:     app.Code,
+		Avatar:   app.Avatar,
+		Address:  app.Address,
+		TenantID: app.TenantID,
+	}
+}
+
+// profileOf 同步给下游的用户资料，写回映射时使用
+func profileOf(user connector.User) model.ProxyUserApp {
+	return model.ProxyUserApp{
+		UserName: user.UserName,
+		Name:     user.Name,
+		Mobile:   user.Mobile,
+		Email:    user.Email,
+		Gender:   user.Gender,
+		NickName: user.NickName,
+		Code:     user.Code,
+		Avatar:   user.Avatar,
+		Address:  user.Address,
+		TenantID: user.TenantID,
+	}
+}
+
+// setProfile 将用户中心的用户资料写入映射
+func setProfile(app *model.ProxyUserApp, user model.XjrUser) {
+	app.UserID = uint64(user.ID)
+	app.UserName = user.UserName
+	app.Name = user.Name
+	app.Gender = user.Gender
+	app.Mobile = user.Mobile
+	app.Email = user.Email
+	app.NickName = user.NickName
+	app.Code = user.Code
+	app.Avatar = user.Avatar
+	app.Address = user.Address
+	app.TenantID = user.TenantID
+}
+
+// remoteIDOf 映射中保存的下游账号ID，未开通时为空
+func remoteIDOf(app model.ProxyUserApp) string {
+	if app.AppUserRef != "" {
+		return app.AppUserRef
+	}
+	if app.AppUserID == 0 {
+		return ""
+	}
+	return strconv.FormatUint(app.AppUserID, 10)
+}
+
+// provisioned 用户是否已在下游应用开通账号
+func provisioned(app model.ProxyUserApp) bool {
+	return remoteIDOf(app) != ""
+}
+
+// newSyncJob builds the outbox job for one operation on a user-app mapping.
+func newSyncJob(app model.ProxyUserApp, operation string, payload syncPayload) (model.SyncJob, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return model.SyncJob{}, fmt.Errorf("failed to marshal %s payload: %w", operation, err)
+	}
+	return model.SyncJob{
+		UserID:         app.UserID,
+		UserName:       app.UserName,
+		AppID:          app.AppID,
+		AppAddress:     app.AppAddress,
+		Operation:      operation,
+		IdempotencyKey: model.SyncJobKey(app.Key(), app.AppID),
+		Payload:        string(data),
+	}, nil
+}
+
+// executeSyncJob runs the job operation through the connector configured for
+// the app and applies the outcome to the user-app mapping.
+func executeSyncJob(ctx context.Context, job *model.SyncJob) error {
+	var payload syncPayload
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	conn, err := connector.ForApp(job.AppID, job.AppAddress)
+	if err != nil {
+		return err
+	}
+	conn = guardedConnector{conn: conn, appID: job.AppID, address: job.AppAddress}
+	// 下游幂等键区分 (用户, 应用, 操作)，同一任务的重试使用相同的键
+	ctx = connector.WithIdempotencyKey(ctx, fmt.Sprintf("%s:%s:%d", job.IdempotencyKey, job.Operation, job.ID))
+
+	var result connector.Result
+	switch job.Operation {
+	case model.SyncOpCreate:
+		result, err = provision(ctx, conn, job.AppID, payload)
+		if err == nil {
+			log.Printf("请求成功: %s (%s app %d)", result.Message, job.UserName, job.AppID)
+			// 下游已开通，请求取消时也需保存账号ID
+			err = db.DB.SetProxyUserAppRemoteID(context.WithoutCancel(ctx), job.UserKey(), job.AppID, result.RemoteID)
+		}
+	case model.SyncOpUpdate:
+		result, err = conn.Update(ctx, payload.RemoteID, payload.User)
+		// 下游已更新才保存新资料，失败时之后的比较仍能发现变更
+		if err == nil {
+			err = db.DB.UpdateProxyUserAppProfile(context.WithoutCancel(ctx), job.UserKey(), job.AppID, profileOf(payload.User))
+		}
+		// 改名后下游账号ID可能变化（如 LDAP 的 DN）
+		if err == nil && result.RemoteID != "" && result.RemoteID != payload.RemoteID {
+			err = db.DB.SetProxyUserAppRemoteID(context.WithoutCancel(ctx), job.UserKey(), job.AppID, result.RemoteID)
+		}
+	case model.SyncOpDisable, model.SyncOpDelete:
+		// 未开通过的账号无需调用下游
+		if payload.RemoteID != "" {
+			if job.Operation == model.SyncOpDisable {
+				result, err = conn.Disable(ctx, payload.RemoteID)
+			} else {
+				result, err = conn.Delete(ctx, payload.RemoteID)
+			}
+		}
+		if err == nil && job.Operation == model.SyncOpDisable {
+			err = db.DB.MarkProxyUserAppDisabled(context.WithoutCancel(ctx), job.UserKey(), job.AppID, result.Deleted)
+		} else if err == nil {
+			err = db.DB.MarkProxyUserAppRemoved(context.WithoutCancel(ctx), job.UserKey(), job.AppID)
+		}
+	default:
+		err = fmt.Errorf("unknown sync operation %q", job.Operation)
+	}
+	job.LastCode, job.LastMessage = result.Code, result.Message
+
+	// 熔断器打开时推迟任务，不占用重试次数
+	var open *breaker.OpenError
+	if errors.As(err, &open) {
+		return &outbox.DeferError{Until: open.RetryAt, Err: err}
+	}
+	return err
+}
+
+// guardedConnector 经应用熔断器调用下游：熔断打开时直接返回 *breaker.OpenError，
+// 只有下游不可达 (connector.ErrUnavailable) 计为失败
+type guardedConnector struct {
+	conn    connector.Connector
+	appID   uint64
+	address string
+}
+
+func (g guardedConnector) call(ctx context.Context, fn func() (connector.Result, error)) (connector.Result, error) {
+	if err := breakers.Allow(g.appID, g.address); err != nil {
+		return connector.Result{}, err
+	}
+	result, err := fn()
+	switch {
+	case ctx.Err() != nil:
+		// 请求被取消，不能说明下游状态
+		breakers.Abandon(g.appID)
+	case errors.Is(err, connector.ErrUnavailable):
+		breakers.Record(g.appID, g.address, err)
+	default:
+		breakers.Record(g.appID, g.address, nil)
+	}
+	return result, err
+}
+
+func (g guardedConnector) Create(ctx context.Context, user connector.User) (connector.Result, error) {
+	return g.call(ctx, func() (connector.Result, error) { return g.conn.Create(ctx, user) })
+}
+
+func (g guardedConnector) Update(ctx context.Context, remoteID string, user connector.User) (connector.Result, error) {
+	return g.call(ctx, func() (connector.Result, error) { return g.conn.Update(ctx, remoteID, user) })
+}
+
+func (g guardedConnector) Disable(ctx context.Context, remoteID string) (connector.Result, error) {
+	return g.call(ctx, func() (connector.Result, error) { return g.conn.Disable(ctx, remoteID) })
+}
+
+func (g guardedConnector) Delete(ctx context.Context, remoteID string) (connector.Result, error) {
+	return g.call(ctx, func() (connector.Result, error) { return g.conn.Delete(ctx, remoteID) })
+}
+
+func (g guardedConnector) Lookup(ctx context.Context, userName string) (connector.Result, error) {
+	return g.call(ctx, func() (connector.Result, error) { return g.conn.Lookup(ctx, userName) })
+}
+
+// provision creates the downstream account, or updates it when the mapping
+// already has one or a lookup by userName finds one, so that repeated grants
+// and retries never create duplicate accounts.
+func provision(ctx context.Context, conn connector.Connector, appID uint64, payload syncPayload) (connector.Result, error) {
+	remoteID := payload.RemoteID
+	if remoteID == "" && connector.LookupBeforeCreate(appID) {
+		found, err := conn.Lookup(ctx, payload.User.UserName)
+		switch {
+		case err == nil:
+			remoteID = found.RemoteID
+		case !errors.Is(err, connector.ErrNotFound):
+			return found, fmt.Errorf("failed to look up %s: %w", payload.User.UserName, err)
+		}
+	}
+	if remoteID == "" {
+		return conn.Create(ctx, payload.User)
+	}
+	result, err := conn.Update(ctx, remoteID, payload.User)
+	if result.RemoteID == "" {
+		result.RemoteID = remoteID
+	}
+	return result, err
+}
+
+// recordSyncResult stores the outcome of a job attempt on the user-app mapping.
+func recordSyncResult(ctx context.Context, job *model.SyncJob) {
+	if err := db.DB.UpdateProxyUserAppSyncState(ctx, job.UserKey(), job.AppID, job.SyncState()); err != nil {
+		log.Printf("Failed to record sync result of job %d: %v", job.ID, err)
+	}
+}
+
+// SyncResult 单个 (用户, 应用) 的同步结果，返回给调用方
+type SyncResult struct {
+	UserName string `json:"userName"`
+	AppID    uint64 `json:"appId"`
+	model.SyncState
+}
+
+// 同步结果在用户中心响应中的字段名和汇总响应头
+const (
+	syncResultsField  = "syncResults"
+	syncSummaryHeader = "X-Sync-Summary"
+)
+
+// skippedResult 未同步的 (用户, 应用)，SyncMessage 为跳过原因
+func skippedResult(userName string, skip *endpoint.SkipError) SyncResult {
+	return SyncResult{
+		UserName: userName,
+		AppID:    skip.AppID,
+		SyncState: model.SyncState{
+			SyncStatus:  model.SyncStatusSkipped,
+			SyncMessage: skip.Reason,
+			SyncDate:    time.Now(),
+		},
+	}
+}
+
+// reportSyncResults returns the per-app results, followed by the skipped apps,
+// to the caller: merged into the user-center JSON response as "syncResults",
+// with a summary header in any case.
+func reportSyncResults(ex *interceptor.Exchange, jobs []model.SyncJob, skipped []SyncResult) {
+	results := make([]SyncResult, 0, len(jobs)+len(skipped))
+	counts := make(map[string]int)
+	for i := range jobs {
+		state := jobs[i].SyncState()
+		counts[state.SyncStatus]++
+		results = append(results, SyncResult{
+			UserName:  jobs[i].UserName,
+			AppID:     jobs[i].AppID,
+			SyncState: state,
+		})
+	}
+	results = append(results, skipped...)
+	counts[model.SyncStatusSkipped] = len(skipped)
+
+	summary := fmt.Sprintf("%s=%d, %s=%d, %s=%d",
+		model.SyncStatusSuccess, counts[model.SyncStatusSuccess],
+		model.SyncStatusRetrying, counts[model.SyncStatusRetrying],
+		model.SyncStatusFailed, counts[model.SyncStatusFailed])
+	if len(skipped) > 0 {
+		summary += fmt.Sprintf(", %s=%d", model.SyncStatusSkipped, len(skipped))
+	}
+	log.Printf("Synced %d user apps: %s", len(results), summary)
+	ex.Header.Set(syncSummaryHeader, summary)
+
+	if err := ex.SetJSONField(syncResultsField, results); err != nil {
+		log.Printf("Sync results not merged into response: %v", err)
+	}
+}
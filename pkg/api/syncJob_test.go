@@ -0,0 +1,152 @@
+package api
+
+import (
+	"center/model"
+	"center/pkg/breaker"
+	"center/pkg/config"
+	"center/pkg/connector"
+	"center/pkg/db"
+	"center/pkg/outbox"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// stubConnector 记录下游调用，fail、failDelete 不为空时更新、删除失败
+type stubConnector struct {
+	fail       error
+	failDelete error
+	updates    []connector.User
+	calls      []string // 操作和下游账号ID，如 "disable remote"
+}
+
+func (s *stubConnector) Create(ctx context.Context, user connector.User) (connector.Result, error) {
+	return connector.Result{RemoteID: "remote"}, nil
+}
+
+func (s *stubConnector) Update(ctx context.Context, remoteID string, user connector.User) (connector.Result, error) {
+	s.updates = append(s.updates, user)
+	s.calls = append(s.calls, "update "+remoteID)
+	return connector.Result{}, s.fail
+}
+
+func (s *stubConnector) Disable(ctx context.Context, remoteID string) (connector.Result, error) {
+	s.calls = append(s.calls, "disable "+remoteID)
+	return connector.Result{}, nil
+}
+
+func (s *stubConnector) Delete(ctx context.Context, remoteID string) (connector.Result, error) {
+	s.calls = append(s.calls, "delete "+remoteID)
+	return connector.Result{}, s.failDelete
+}
+
+func (s *stubConnector) Lookup(ctx context.Context, userName string) (connector.Result, error) {
+	return connector.Result{}, connector.ErrNotFound
+}
+
+var stub = &stubConnector{}
+
+func init() {
+	connector.Register("stub", func(app connector.App) (connector.Connector, error) { return stub, nil })
+}
+
+func openTestDB(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// setupSync 使用已迁移的状态库、只含用户 alice (1) 和应用 10（jos_app.id 5）的用户中心库
+// 以及 stub 连接器初始化同步依赖
+func setupSync(t *testing.T) {
+	t.Helper()
+	state := openTestDB(t, "state.db")
+	jos := openTestDB(t, "jos.db")
+	for _, stmt := range []string{
+		"CREATE TABLE xjr_user (id integer PRIMARY KEY, user_name varchar(25), delete_mark integer DEFAULT 0, enabled_mark integer DEFAULT 1)",
+		"INSERT INTO xjr_user (id, user_name) VALUES (1, 'alice')",
+	} {
+		if err := jos.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := jos.AutoMigrate(&model.JosApp{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := jos.Create(&model.JosApp{ID: 5, AppID: 10, AppName: "crm"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.NewStateMigrator(state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MigrateState(context.Background(), state, m, 0); err != nil {
+		t.Fatal(err)
+	}
+	orig := db.DB
+	db.DB = db.Database{JosDb: jos, StateDb: state}
+	t.Cleanup(func() { db.DB = orig })
+	if err := connector.Init(config.DownstreamConfig{}, map[uint64]config.AppConfig{10: {Connector: "stub"}}); err != nil {
+		t.Fatal(err)
+	}
+	breakers = breaker.NewRegistry(config.BreakerConfig{})
+	syncPool = outbox.NewPool(config.OutboxConfig{InlineConcurrency: 1, MaxAttempts: 3}, executeSyncJob, recordSyncResult)
+	*stub = stubConnector{}
+}
+
+func TestUpdateJobSavesProfileOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	setupSync(t)
+	alice := model.UserKey{ID: 1, UserName: "alice"}
+	if _, err := db.DB.MergeProxyUserApps(ctx, db.ProxyUserAppMerge{User: alice, Upsert: []model.ProxyUserApp{{AppID: 10, Email: "alice@old.test"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.SetProxyUserAppRemoteID(ctx, alice, 10, "remote"); err != nil {
+		t.Fatal(err)
+	}
+	apps, err := db.DB.GetProxyUserApps(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated := apps[0]
+	setProfile(&updated, model.XjrUser{ID: 1, UserName: "alice", Email: "alice@new.test"})
+	job, err := newSyncJob(apps[0], model.SyncOpUpdate, syncPayload{User: userOf(updated), RemoteID: "remote"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := func() string {
+		apps, err := db.DB.GetProxyUserApps(ctx, alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return apps[0].Email
+	}
+
+	// 下游更新失败时保留原资料，之后的比较仍能发现变更
+	stub.fail = errors.New("rejected")
+	if err := executeSyncJob(ctx, &job); err == nil {
+		t.Fatal("executeSyncJob() succeeded with a failing connector")
+	}
+	if got := email(); got != "alice@old.test" {
+		t.Errorf("profile after a failed update = %s, want the old one", got)
+	}
+
+	stub.fail = nil
+	if err := executeSyncJob(ctx, &job); err != nil {
+		t.Fatal(err)
+	}
+	if got := email(); got != "alice@new.test" {
+		t.Errorf("profile after a successful update = %s, want the new one", got)
+	}
+	if len(stub.updates) != 2 || stub.updates[1].Email != "alice@new.test" {
+		t.Errorf("updates sent = %+v", stub.updates)
+	}
+}
@@ -1,20 +1,19 @@
 package api
 
 import (
-	"bytes"
 	"center/model"
 	"center/pkg/db"
+	"center/pkg/interceptor"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"log"
 	"strconv"
 	"strings"
-
-	"gorm.io/gorm"
 )
 
 type UserRequest struct {
+	ID              string   `json:"id"`
 	UserName        string   `json:"userName"`
 	ConfirmPassword string   `json:"confirmPassword"`
 	DepartmentID    string   `json:"departmentId"`
@@ -27,165 +26,120 @@ type UserRequest struct {
 	Password        string   `json:"password"`
 }
 
-// 请求体结构
-type UserSyncRequest struct {
-	UserName string `json:"userName"`
-	Name     string `json:"name"`
-	Phone    string `json:"phone"`
-	Email    string `json:"email"`
-	Sex      int    `json:"sex"`
-}
-
-// 响应体结构
-type Response struct {
-	Code    int           `json:"code"`
-	Message string        `json:"message"`
-	Data    []AppUserData `json:"data"`
-}
-
-type AppUserData struct {
-	UserName string `json:"userName"`
-	UserID   string `json:"userId"`
-}
-
 const contentTypeJSON = "application/json"
 
-func SyncUser(r *http.Request, body []byte) error {
+// SyncUser provisions the user to the apps in AppIDList once the user center
+// has accepted the create or edit request.
+func SyncUser(ex *interceptor.Exchange) error {
 	// 检查Content-Type
-	if !strings.Contains(r.Header.Get("Content-Type"), contentTypeJSON) {
+	if !strings.Contains(ex.Request.Header.Get("Content-Type"), contentTypeJSON) {
 		return fmt.Errorf("Content-Type must be %s", contentTypeJSON)
 	}
 
 	// 解析JSON到结构体
 	var req UserRequest
-	if err := json.Unmarshal(body, &req); err != nil {
+	if err := json.Unmarshal(ex.Body, &req); err != nil {
 		return fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
 	// 这里同步应用，可能是在新建用户的时候，也有可能是在编辑用户
-	if req.SyncFlag == 1 {
-		userApps, err := buildUserApps(req)
-		if err != nil {
-			return err
-		}
-		err = handleSync(userApps)
-		if err != nil {
-			return fmt.Errorf("failed to handle sync %w", err)
-		}
+	if req.SyncFlag != 1 {
+		return nil
 	}
-	return nil
-}
 
-// buildUserApps extracts the logic for building userApps from the request.
-func buildUserApps(req UserRequest) ([]model.ProxyUserApp, error) {
-	var userApps []model.ProxyUserApp
-	for _, appIDStr := range req.AppIDList {
-		// 字符串转换为uint64
-		id, err := strconv.ParseUint(appIDStr, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("invalid appId %s: %w", appIDStr, err)
-		}
-
-		// 获取应用的发布地址
-		publishAddressInside, err := getAddressesByID(id)
-		if len(publishAddressInside) == 0 || err != nil {
-			return nil, fmt.Errorf("failed to get addresses for id %d: %w", id, err)
-		}
-
-		// 获取app_id
-		appID, err := db.DB.GetJosAppIDByID(id)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get app ID for id %d: %w", id, err)
-		}
-		// 将用户信息和应用发布地址同步到sqlite数据库
-		var userApp model.ProxyUserApp
-		userApp.UserName = req.UserName
-		userApp.Name = req.Name
-		userApp.Mobile = req.Mobile
-		userApp.Email = req.Email
-		userApp.AppID = appID
-		userApp.AppAddress = publishAddressInside
-
-		userApps = append(userApps, userApp)
+	// 用户中心拒绝时不同步
+	result, ok := acceptedByUpstream(ex)
+	if !ok {
+		log.Printf("User center rejected user %s (status %d), skipping sync", req.UserName, ex.StatusCode)
+		return nil
 	}
-	return userApps, nil
-}
-
-func getAddressesByID(appID uint64) (string, error) {
-	var app model.JosApp
-	result := db.DB.JosDb.Select("publish_address_inside").
-		Where("id = ?", appID).
-		First(&app)
 
-	if result.Error != nil {
-		if result.Error == gorm.ErrRecordNotFound {
-			return "", fmt.Errorf("application with ID %d not found", appID)
-		}
-		return "", fmt.Errorf("database error: %v", result.Error)
+	ctx := ex.Request.Context()
+	user, err := resolveUser(ctx, req, result)
+	if err != nil {
+		return err
 	}
-
-	return app.PublishAddressInside, nil
+	userApps, skipped, err := buildAppsForUser(ctx, user, req.AppIDList)
+	if err != nil {
+		return err
+	}
+	jobs, err := handleSync(ctx, userApps)
+	if err != nil {
+		return fmt.Errorf("failed to handle sync %w", err)
+	}
+	reportSyncResults(ex, jobs, skipped)
+	return nil
 }
 
-func handleSync(userApps []model.ProxyUserApp) error {
-	for index, app := range userApps {
-		user := UserSyncRequest{
-			UserName: app.UserName,
-			Name:     app.Name,
-			Phone:    app.Mobile,
-			Email:    app.Email,
-			Sex:      0,
-		}
-
-		response, err := sendUserSyncRequest(app.AppAddress, user)
+// resolveUser loads the user by the ID returned from the user center (new users)
+// or sent in the request (edits), falling back to the userName. Mappings are
+// keyed by the user ID, so a user that cannot be found is an error.
+func resolveUser(ctx context.Context, req UserRequest, result upstreamResult) (model.XjrUser, error) {
+	id, ok := result.ID()
+	if !ok && req.ID != "" {
+		parsed, err := strconv.ParseUint(req.ID, 10, 64)
 		if err != nil {
-			return err
-		}
-
-		if response.Code == 1 && len(response.Data) > 0 {
-			fmt.Printf("请求成功: %s\n", response.Message)
-			userID, err := strconv.ParseUint(response.Data[0].UserID, 10, 64)
-			if err != nil {
-				return fmt.Errorf("failed to parse userId '%s' to uint64: %w", response.Data[0].UserID, err)
-			}
-			userApps[index].AppUserID = userID
-		} else {
-			fmt.Printf("请求失败: %s (错误码: %d)\n", response.Message, response.Code)
+			return model.XjrUser{}, fmt.Errorf("invalid user ID %s: %w", req.ID, err)
 		}
+		id, ok = parsed, true
 	}
-
-	return db.DB.UpdateProxyUser(userApps)
-}
-
-func sendUserSyncRequest(appAddress string, user UserSyncRequest) (*Response, error) {
-	jsonData, err := json.Marshal(user)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal user data: %w", err)
+	if ok {
+		return db.DB.GetUserByID(ctx, id)
 	}
-
-	req, err := http.NewRequest("POST", appAddress, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if req.UserName == "" {
+		return model.XjrUser{}, fmt.Errorf("request has neither a user ID nor a userName")
 	}
-	req.Header.Set("Content-Type", contentTypeJSON)
-	req.Header.Set("Accept", contentTypeJSON)
+	return db.DB.GetUserByUserName(ctx, req.UserName)
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+// handleSync merges the user-app mappings and runs one downstream sync job per
+// (user, app) in parallel, returning the jobs in the order of userApps. Merged
+// mappings keep their downstream account IDs, so that a repeated grant updates
+// those accounts. Failed jobs stay in the outbox and are retried by the workers
+// instead of failing the user-center request.
+func handleSync(ctx context.Context, userApps []model.ProxyUserApp) ([]model.SyncJob, error) {
+	if len(userApps) == 0 {
+		return nil, nil
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	merged := make(map[model.UserKey]map[uint64]model.ProxyUserApp)
+	for _, apps := range groupByUser(userApps) {
+		user := apps[0].Key()
+		result, err := db.DB.MergeProxyUserApps(ctx, db.ProxyUserAppMerge{User: user, Upsert: apps})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Merged mappings of %s: %d added, %d changed", user, len(result.Added), len(result.Changed))
+		byApp := make(map[uint64]model.ProxyUserApp, len(result.Apps))
+		for _, app := range result.Apps {
+			byApp[app.AppID] = app
+		}
+		merged[user] = byApp
 	}
 
-	var response Response
-	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+	jobs := make([]model.SyncJob, 0, len(userApps))
+	for _, app := range userApps {
+		app = merged[app.Key()][app.AppID]
+		job, err := newSyncJob(app, model.SyncOpCreate, syncPayload{User: userOf(app), RemoteID: remoteIDOf(app)})
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
 	}
+	return syncPool.Dispatch(ctx, jobs)
+}
 
-	return &response, nil
+// groupByUser 按用户分组，保持首次出现的顺序
+func groupByUser(userApps []model.ProxyUserApp) [][]model.ProxyUserApp {
+	index := make(map[model.UserKey]int)
+	var groups [][]model.ProxyUserApp
+	for _, app := range userApps {
+		i, ok := index[app.Key()]
+		if !ok {
+			i = len(groups)
+			index[app.Key()] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], app)
+	}
+	return groups
 }
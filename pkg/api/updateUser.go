@@ -0,0 +1,76 @@
+package api
+
+import (
+	"center/model"
+	"center/pkg/db"
+	"center/pkg/interceptor"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// UpdateUserProfile pushes the edited profile to every app the user is already
+// provisioned to, once the user center has accepted the edit. Only mappings
+// whose stored profile differs from the user record are updated; the mapping
+// keeps the old profile until the app has accepted the new one.
+func UpdateUserProfile(ex *interceptor.Exchange) error {
+	// 检查Content-Type
+	if !strings.Contains(ex.Request.Header.Get("Content-Type"), contentTypeJSON) {
+		return fmt.Errorf("Content-Type must be %s", contentTypeJSON)
+	}
+
+	// 解析JSON到结构体
+	var req UserRequest
+	if err := json.Unmarshal(ex.Body, &req); err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	// 用户中心拒绝时不同步
+	result, ok := acceptedByUpstream(ex)
+	if !ok {
+		log.Printf("User center rejected edit of user %s (status %d), skipping update", req.UserName, ex.StatusCode)
+		return nil
+	}
+
+	ctx := ex.Request.Context()
+	user, err := resolveUser(ctx, req, result)
+	if err != nil {
+		return err
+	}
+	apps, err := db.DB.GetProxyUserApps(ctx, user.Key())
+	if err != nil {
+		return err
+	}
+
+	var jobs []model.SyncJob
+	for _, app := range apps {
+		if !provisioned(app) || !profileChanged(app, user) {
+			continue
+		}
+		updated := app
+		setProfile(&updated, user)
+		job, err := newSyncJob(app, model.SyncOpUpdate, syncPayload{User: userOf(updated), RemoteID: remoteIDOf(app)})
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, job)
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	jobs, err = syncPool.Dispatch(ctx, jobs)
+	if err != nil {
+		return fmt.Errorf("failed to dispatch profile update: %w", err)
+	}
+	reportSyncResults(ex, jobs, nil)
+	return nil
+}
+
+// profileChanged 比较映射中保存的资料与用户中心的用户资料
+func profileChanged(app model.ProxyUserApp, user model.XjrUser) bool {
+	updated := app
+	setProfile(&updated, user)
+	return userOf(updated) != userOf(app) || updated.UserID != app.UserID
+}
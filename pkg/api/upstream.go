@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"center/pkg/config"
+	"center/pkg/interceptor"
+	"encoding/json"
+	"slices"
+	"strconv"
+)
+
+// 用户中心统一响应结构，字段名见 upstreamResponse
+type upstreamResult struct {
+	Code *int
+	Msg  string
+	Data json.RawMessage
+}
+
+// 用户中心响应结构配置，由 Interceptors 设置
+var upstreamResponse = config.Default().Upstream.Response
+
+// acceptedByUpstream reports whether the user center accepted the change: a 2xx
+// status and, for a JSON envelope, a success business code.
+func acceptedByUpstream(ex *interceptor.Exchange) (upstreamResult, bool) {
+	var result upstreamResult
+	if ex.StatusCode < 200 || ex.StatusCode > 299 {
+		return result, false
+	}
+	if !result.decode(ex.ResponseBody) {
+		// 非标准响应体，仅以HTTP状态码为准
+		return result, true
+	}
+	return result, slices.Contains(upstreamResponse.SuccessCodes, *result.Code)
+}
+
+// decode 按配置的字段名解析响应体，不是带业务码的 JSON 对象时返回 false
+func (u *upstreamResult) decode(body []byte) bool {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return false
+	}
+	raw, ok := envelope[upstreamResponse.CodeField]
+	var code int
+	if !ok || string(raw) == "null" || json.Unmarshal(raw, &code) != nil {
+		return false
+	}
+	u.Code = &code
+	json.Unmarshal(envelope[upstreamResponse.MessageField], &u.Msg)
+	u.Data = envelope[upstreamResponse.DataField]
+	return true
+}
+
+// ID extracts an entity ID from the response data, which may be a number, a
+// numeric string or an object with an "id" or "userId" field.
+func (u upstreamResult) ID() (uint64, bool) {
+	data := bytes.TrimSpace(u.Data)
+	if len(data) == 0 {
+		return 0, false
+	}
+	if data[0] == '{' {
+		var obj struct {
+			ID     json.RawMessage `json:"id"`
+			UserID json.RawMessage `json:"userId"`
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return 0, false
+		}
+		if id, ok := parseID(obj.ID); ok {
+			return id, true
+		}
+		return parseID(obj.UserID)
+	}
+	return parseID(data)
+}
+
+// parseID 解析数字或数字字符串形式的ID
+func parseID(raw json.RawMessage) (uint64, bool) {
+	if len(raw) == 0 {
+		return 0, false
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		s = string(raw)
+	}
+	id, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"center/pkg/config"
+	"center/pkg/interceptor"
+	"net/http"
+	"testing"
+)
+
+func TestAcceptedByUpstream(t *testing.T) {
+	custom := config.UpstreamResponseConfig{CodeField: "status", MessageField: "message", DataField: "result", SuccessCodes: []int{1}}
+	for _, tc := range []struct {
+		name     string
+		envelope config.UpstreamResponseConfig
+		status   int
+		body     string
+		accepted bool
+		id       uint64
+	}{
+		{"success code", upstreamResponse, http.StatusOK, `{"code":200,"msg":"ok","data":{"id":"42"}}`, true, 42},
+		{"business error", upstreamResponse, http.StatusOK, `{"code":500,"msg":"duplicate","data":null}`, false, 0},
+		{"http error", upstreamResponse, http.StatusBadRequest, `{"code":0}`, false, 0},
+		{"not json", upstreamResponse, http.StatusOK, `ok`, true, 0},
+		{"no code", upstreamResponse, http.StatusOK, `{"code":null,"data":7}`, true, 0},
+		{"custom success", custom, http.StatusOK, `{"status":1,"message":"","result":7}`, true, 7},
+		{"custom error", custom, http.StatusOK, `{"status":0,"code":0,"result":7}`, false, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			orig := upstreamResponse
+			upstreamResponse = tc.envelope
+			t.Cleanup(func() { upstreamResponse = orig })
+
+			result, ok := acceptedByUpstream(&interceptor.Exchange{StatusCode: tc.status, ResponseBody: []byte(tc.body)})
+			if ok != tc.accepted {
+				t.Errorf("accepted = %v, want %v", ok, tc.accepted)
+			}
+			if id, _ := result.ID(); ok && id != tc.id {
+				t.Errorf("ID() = %d, want %d", id, tc.id)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package breaker
+
+import (
+	"center/pkg/config"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"    // 正常调用
+	StateOpen     = "open"      // 连续失败，暂停调用直到冷却结束
+	StateHalfOpen = "half-open" // 冷却结束，放行探测请求
+)
+
+// ErrOpen 熔断器打开，调用被拒绝
+var ErrOpen = errors.New("circuit breaker open")
+
+// OpenError 熔断器打开时返回，RetryAt 为冷却结束时间
+type OpenError struct {
+	AppID   uint64
+	RetryAt time.Time
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker open for app %d until %s", e.AppID, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *OpenError) Unwrap() error { return ErrOpen }
+
+// Status 单个应用的熔断器和健康状态
+type Status struct {
+	AppID               uint64    `json:"appId"`
+	Address             string    `json:"address"`
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	TotalSuccesses      int64     `json:"totalSuccesses"`
+	TotalFailures       int64     `json:"totalFailures"`
+	LastError           string    `json:"lastError,omitempty"`
+	LastSuccess         time.Time `json:"lastSuccess"`
+	LastFailure         time.Time `json:"lastFailure"`
+	OpenedAt            time.Time `json:"openedAt"`
+	RetryAt             time.Time `json:"retryAt"`
+}
+
+// breaker 单个应用的熔断器
+type breaker struct {
+	Status
+	probes int // 半开状态下正在执行的探测请求数
+}
+
+// Registry 按应用ID维护熔断器
+type Registry struct {
+	cfg      config.BreakerConfig
+	now      func() time.Time
+	mu       sync.Mutex
+	breakers map[uint64]*breaker
+}
+
+// NewRegistry creates the breakers for all apps with the same thresholds.
+func NewRegistry(cfg config.BreakerConfig) *Registry {
+	return &Registry{cfg: cfg, now: time.Now, breakers: make(map[uint64]*breaker)}
+}
+
+// Allow reports whether a call to the app may proceed. When it returns nil the
+// caller must report the outcome with Record. While the breaker is open it
+// returns an *OpenError carrying the time the app may be retried.
+func (r *Registry) Allow(appID uint64, address string) error {
+	if !r.cfg.Enabled {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.get(appID, address)
+	now := r.now()
+	switch b.State {
+	case StateOpen:
+		if now.Before(b.RetryAt) {
+			return &OpenError{AppID: appID, RetryAt: b.RetryAt}
+		}
+		b.State = StateHalfOpen
+		fallthrough
+	case StateHalfOpen:
+		if b.probes >= r.cfg.HalfOpenProbes {
+			return &OpenError{AppID: appID, RetryAt: now.Add(r.cfg.Cooldown)}
+		}
+		b.probes++
+	}
+	return nil
+}
+
+// Record reports the outcome of a call allowed by Allow. failure is the error
+// if the app was unreachable, nil otherwise.
+func (r *Registry) Record(appID uint64, address string, failure error) {
+	if !r.cfg.Enabled {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.get(appID, address)
+	now := r.now()
+	if b.State == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+
+	if failure == nil {
+		b.TotalSuccesses++
+		b.LastSuccess = now
+		b.ConsecutiveFailures = 0
+		if b.State != StateClosed {
+			b.State, b.OpenedAt, b.RetryAt = StateClosed, time.Time{}, time.Time{}
+		}
+		return
+	}
+
+	b.TotalFailures++
+	b.LastFailure = now
+	b.LastError = failure.Error()
+	b.ConsecutiveFailures++
+	// 半开探测失败或连续失败达到阈值时打开
+	if b.State == StateHalfOpen || b.ConsecutiveFailures >= r.cfg.FailureThreshold {
+		b.State, b.OpenedAt, b.RetryAt = StateOpen, now, now.Add(r.cfg.Cooldown)
+	}
+}
+
+// Abandon releases a call allowed by Allow whose outcome says nothing about
+// the app, such as a cancelled request.
+func (r *Registry) Abandon(appID uint64) {
+	if !r.cfg.Enabled {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b, ok := r.breakers[appID]; ok && b.State == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// Snapshot returns the status of every app that has been called, by app ID.
+func (r *Registry) Snapshot() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]Status, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		list = append(list, b.Status)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AppID < list[j].AppID })
+	return list
+}
+
+func (r *Registry) get(appID uint64, address string) *breaker {
+	b, ok := r.breakers[appID]
+	if !ok {
+		b = &breaker{Status: Status{AppID: appID, State: StateClosed}}
+		r.breakers[appID] = b
+	}
+	if address != "" {
+		b.Address = address
+	}
+	return b
+}
@@ -0,0 +1,77 @@
+package breaker
+
+import (
+	"center/pkg/config"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewRegistry(config.BreakerConfig{Enabled: true, FailureThreshold: 2, Cooldown: time.Minute, HalfOpenProbes: 1})
+	r.now = func() time.Time { return now }
+	down := errors.New("connection refused")
+
+	call := func(failure error) error {
+		t.Helper()
+		if err := r.Allow(1, "http://app"); err != nil {
+			return err
+		}
+		r.Record(1, "http://app", failure)
+		return nil
+	}
+
+	// 达到阈值前保持关闭，成功调用清零连续失败
+	call(down)
+	call(nil)
+	call(down)
+	if state := r.Snapshot()[0].State; state != StateClosed {
+		t.Fatalf("state after non-consecutive failures = %s", state)
+	}
+	call(down)
+	var open *OpenError
+	if err := r.Allow(1, ""); !errors.As(err, &open) || !errors.Is(err, ErrOpen) || !open.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Allow() on an open breaker = %v", err)
+	}
+
+	// 冷却结束后只放行一个探测请求，探测失败重新打开
+	now = now.Add(time.Minute)
+	if err := r.Allow(1, ""); err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if err := r.Allow(1, ""); !errors.Is(err, ErrOpen) {
+		t.Errorf("second probe = %v, want ErrOpen", err)
+	}
+	r.Record(1, "", down)
+	if status := r.Snapshot()[0]; status.State != StateOpen || !status.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("status after a failed probe = %+v", status)
+	}
+
+	// 取消的探测不影响状态，成功的探测关闭熔断器
+	now = now.Add(time.Minute)
+	if err := r.Allow(1, ""); err != nil {
+		t.Fatal(err)
+	}
+	r.Abandon(1)
+	if err := call(nil); err != nil {
+		t.Fatalf("probe after an abandoned one rejected: %v", err)
+	}
+	status := r.Snapshot()[0]
+	if status.State != StateClosed || status.ConsecutiveFailures != 0 || status.TotalFailures != 4 || status.Address != "http://app" {
+		t.Errorf("status after a successful probe = %+v", status)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	r := NewRegistry(config.BreakerConfig{FailureThreshold: 1})
+	for i := 0; i < 3; i++ {
+		if err := r.Allow(1, ""); err != nil {
+			t.Fatal(err)
+		}
+		r.Record(1, "", errors.New("down"))
+	}
+	if len(r.Snapshot()) != 0 {
+		t.Errorf("disabled registry tracked %v", r.Snapshot())
+	}
+}
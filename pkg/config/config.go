@@ -0,0 +1,841 @@
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 默认配置文件路径，文件不存在时使用内置默认值
+const DefaultPath = "config.yaml"
+
+// Config 代理服务的完整配置
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Upstream UpstreamConfig `yaml:"upstream"`
+	Jos      JosConfig      `yaml:"jos"`
+	State    StateConfig    `yaml:"state"`
+	Outbox   OutboxConfig   `yaml:"outbox"`
+
+	SCIMServer SCIMServerConfig `yaml:"scimServer"`
+	Downstream DownstreamConfig `yaml:"downstream"`
+	Endpoints  EndpointConfig   `yaml:"endpoints"`
+	Breaker    BreakerConfig    `yaml:"breaker"`
+	Admin      AdminConfig      `yaml:"admin"`
+
+	// 下游应用配置，按 jos_app.app_id 配置，未配置的应用使用默认连接器
+	Apps map[uint64]AppConfig `yaml:"apps"`
+
+	// 按名称覆盖拦截器的启用状态和路由
+	Interceptors map[string]InterceptorConfig `yaml:"interceptors"`
+}
+
+// ServerConfig 代理监听配置
+type ServerConfig struct {
+	Listen       string        `yaml:"listen"`
+	ReadTimeout  time.Duration `yaml:"readTimeout"`
+	WriteTimeout time.Duration `yaml:"writeTimeout"`
+	// 收到退出信号后等待进行中请求完成的最长时间
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+// UpstreamConfig 用户中心(join-user-center)连接配置
+type UpstreamConfig struct {
+	BaseURL            string        `yaml:"baseURL"`
+	Timeout            time.Duration `yaml:"timeout"`
+	MaxIdleConns       int           `yaml:"maxIdleConns"`
+	IdleConnTimeout    time.Duration `yaml:"idleConnTimeout"`
+	DisableCompression bool          `yaml:"disableCompression"`
+	TLS                TLSConfig     `yaml:"tls"`
+	// 用户中心响应体结构，拦截器据此判断变更是否成功
+	Response UpstreamResponseConfig `yaml:"response"`
+}
+
+// UpstreamResponseConfig 用户中心统一响应结构，默认 {"code":0,"msg":"","data":...}
+type UpstreamResponseConfig struct {
+	CodeField    string `yaml:"codeField"`    // 业务码字段
+	MessageField string `yaml:"messageField"` // 提示信息字段
+	DataField    string `yaml:"dataField"`    // 数据字段，新建用户时从中读取用户ID
+	SuccessCodes []int  `yaml:"successCodes"` // 表示成功的业务码
+}
+
+// TLSConfig 出站连接的 TLS 配置，证书文件变化后自动重新加载
+type TLSConfig struct {
+	CAFile         string        `yaml:"caFile"`         // 信任的 CA 证书（PEM），配置后替代系统 CA
+	CertFile       string        `yaml:"certFile"`       // 客户端证书（mTLS）
+	KeyFile        string        `yaml:"keyFile"`        // 客户端证书私钥
+	MinVersion     string        `yaml:"minVersion"`     // 最低 TLS 版本：1.0、1.1、1.2、1.3
+	ServerName     string        `yaml:"serverName"`     // 校验服务端证书使用的名称，默认为连接的主机名
+	ReloadInterval time.Duration `yaml:"reloadInterval"` // 检查证书文件变化的间隔，默认 30s
+}
+
+// Validate checks that the TLS settings are consistent.
+func (t TLSConfig) Validate() error {
+	var errs []error
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		errs = append(errs, errors.New("certFile and keyFile must be set together"))
+	}
+	if _, ok := TLSVersions[t.MinVersion]; t.MinVersion != "" && !ok {
+		errs = append(errs, fmt.Errorf("minVersion %q must be one of 1.0, 1.1, 1.2, 1.3", t.MinVersion))
+	}
+	if t.ReloadInterval < 0 {
+		errs = append(errs, errors.New("reloadInterval must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+// TLSVersions 可配置的最低 TLS 版本
+var TLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// JosConfig jos MySQL 数据库配置，DSN 非空时优先于 Host/User/Password/Name；
+// 账号和密码没有默认值，必须配置
+type JosConfig struct {
+	DSN             string        `yaml:"dsn"`
+	Host            string        `yaml:"host"`
+	User            string        `yaml:"user"`
+	Password        string        `yaml:"password"`
+	PasswordFile    string        `yaml:"passwordFile"` // 优先于 password
+	Name            string        `yaml:"name"`
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	MaxOpenConns    int           `yaml:"maxOpenConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime"`
+	LogLevel        string        `yaml:"logLevel"`
+	SlowThreshold   time.Duration `yaml:"slowThreshold"`
+}
+
+// StateConfig 代理自身状态库配置：默认为本地 sqlite 文件，
+// 多副本部署时使用共享的 mysql 或 postgres
+type StateConfig struct {
+	Driver          string        `yaml:"driver"` // sqlite | mysql | postgres
+	Path            string        `yaml:"path"`   // sqlite 数据库文件
+	DSN             string        `yaml:"dsn"`    // mysql/postgres 连接串
+	MaxIdleConns    int           `yaml:"maxIdleConns"`
+	MaxOpenConns    int           `yaml:"maxOpenConns"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime"`
+	LogLevel        string        `yaml:"logLevel"`
+	SlowThreshold   time.Duration `yaml:"slowThreshold"`
+	// 启动时执行未执行的迁移，多个实例共用 MySQL/PostgreSQL 时以数据库锁保证只执行一次；
+	// 关闭时需先运行 migrate 子命令，有未执行的迁移时拒绝启动
+	AutoMigrate bool `yaml:"autoMigrate"`
+}
+
+// OutboxConfig 下游同步任务队列配置
+type OutboxConfig struct {
+	Workers           int           `yaml:"workers"`           // 并发执行任务的 worker 数
+	InlineConcurrency int           `yaml:"inlineConcurrency"` // 请求内立即执行同步时的最大并发数
+	PollInterval      time.Duration `yaml:"pollInterval"`      // 轮询到期任务的间隔
+	BatchSize         int           `yaml:"batchSize"`         // 每次领取的最大任务数
+	MaxAttempts       int           `yaml:"maxAttempts"`       // 超过后进入死信
+	BaseBackoff       time.Duration `yaml:"baseBackoff"`       // 首次重试等待时间，之后指数增长
+	MaxBackoff        time.Duration `yaml:"maxBackoff"`        // 重试等待时间上限
+	// 执行中超过该时长未更新的任务视为中断，重新置为待执行；
+	// 0 表示启动时重新执行全部执行中的任务，仅适用于单实例
+	RunningTimeout time.Duration `yaml:"runningTimeout"`
+}
+
+// SCIMServerConfig 代理对外提供的 SCIM 2.0 只读接口 /scim/v2/{appId}/Users、/Groups
+type SCIMServerConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	BearerToken string `yaml:"bearerToken"` // 调用方需携带 Authorization: Bearer <token>
+	MaxResults  int    `yaml:"maxResults"`  // 单页最大条数
+	// 组资源中返回的成员数上限，超出时需以 excludedAttributes=members 查询组，成员改由 /Users 分页获取
+	MaxGroupMembers int `yaml:"maxGroupMembers"`
+}
+
+// DownstreamConfig 调用下游应用的超时和共享连接池配置
+type DownstreamConfig struct {
+	Timeout             time.Duration            `yaml:"timeout"`             // 单次下游调用的超时
+	Timeouts            map[string]time.Duration `yaml:"timeouts"`            // 按操作覆盖超时，见 Operations
+	MaxIdleConns        int                      `yaml:"maxIdleConns"`        // 所有下游应用共用的空闲连接数上限
+	MaxIdleConnsPerHost int                      `yaml:"maxIdleConnsPerHost"` // 每个下游主机的空闲连接数上限
+	IdleConnTimeout     time.Duration            `yaml:"idleConnTimeout"`
+}
+
+// EndpointConfig 由 jos_app 解析下游应用同步地址的规则
+type EndpointConfig struct {
+	// 参与同步的 jos_app.status（不区分大小写），为空时不检查
+	Statuses []string `yaml:"statuses"`
+	// 优先使用的地址：inside（publish_address_inside）或 outside（publish_address_outside）
+	Prefer string `yaml:"prefer"`
+	// 优先地址不可达时改用另一个地址
+	Fallback bool `yaml:"fallback"`
+	// 同步路径模板，拼接在地址后；为空时地址即同步地址
+	Path          string        `yaml:"path"`
+	ProbeTimeout  time.Duration `yaml:"probeTimeout"`  // 检测地址可达的连接超时，0 表示不检测
+	ProbeInterval time.Duration `yaml:"probeInterval"` // 检测结果的缓存时间
+	// 按 jos_app.env_id 覆盖
+	Environments map[uint64]EndpointOverride `yaml:"environments"`
+}
+
+// EndpointOverride 按环境或应用覆盖的地址规则，未设置的字段沿用上一级
+type EndpointOverride struct {
+	Prefer   string `yaml:"prefer"`
+	Fallback *bool  `yaml:"fallback"`
+	Path     string `yaml:"path"`
+}
+
+// 状态库驱动
+const (
+	StateDriverSQLite   = "sqlite"
+	StateDriverMySQL    = "mysql"
+	StateDriverPostgres = "postgres"
+)
+
+// 可选的优先地址
+const (
+	AddressInside  = "inside"
+	AddressOutside = "outside"
+)
+
+// Operations 可单独配置超时的下游操作
+var Operations = []string{"create", "update", "disable", "delete", "lookup"}
+
+// BreakerConfig 下游应用熔断配置，每个应用独立计数
+type BreakerConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	FailureThreshold int           `yaml:"failureThreshold"` // 连续失败多少次后打开
+	Cooldown         time.Duration `yaml:"cooldown"`         // 打开后多久进入半开
+	HalfOpenProbes   int           `yaml:"halfOpenProbes"`   // 半开时同时放行的探测请求数
+}
+
+// AdminConfig 管理接口配置
+type AdminConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	BearerToken string `yaml:"bearerToken"` // 调用方需携带 Authorization: Bearer <token>
+}
+
+// AppConfig 单个下游应用的配置
+type AppConfig struct {
+	Connector string     `yaml:"connector"` // 连接器名称：default、scim、ldap
+	SCIM      SCIMConfig `yaml:"scim"`
+	LDAP      LDAPConfig `yaml:"ldap"`
+	// 创建前是否先按账号查找下游已有账号；default 连接器默认关闭，其他连接器默认开启
+	Lookup *bool `yaml:"lookup"`
+	// default 连接器的可选接口，未开启时只调用 POST {地址}
+	Default DefaultConnectorConfig `yaml:"default"`
+	// 覆盖 downstream.timeout 和 downstream.timeouts
+	Timeout  time.Duration            `yaml:"timeout"`
+	Timeouts map[string]time.Duration `yaml:"timeouts"`
+	// 覆盖 endpoints 的地址规则
+	Endpoint EndpointOverride `yaml:"endpoint"`
+	// 调用下游 HTTP 接口的认证方式，default 和 scim 连接器使用
+	Auth AuthConfig `yaml:"auth"`
+	// 连接下游的 TLS 配置，ldap 连接器用于 ldaps 和 StartTLS
+	TLS TLSConfig `yaml:"tls"`
+	// 出站请求体模板，仅 default 连接器使用，未配置时使用固定的请求体
+	Mapping MappingConfig `yaml:"mapping"`
+	// 下游响应的成功判定，仅 default 连接器使用
+	Response ResponseConfig `yaml:"response"`
+}
+
+// DefaultConnectorConfig default 连接器在 POST 创建之外提供的接口
+type DefaultConnectorConfig struct {
+	Update bool `yaml:"update"` // PUT {地址}/{id} 更新；关闭时更新也以 POST 提交
+	Delete bool `yaml:"delete"` // DELETE {地址}/{id} 删除和停用；关闭时下游账号保留
+}
+
+// ResponseConfig 下游响应的成功判定和下游账号ID的读取位置，未设置的字段使用默认值
+type ResponseConfig struct {
+	SuccessStatus []string `yaml:"successStatus"` // 成功的 HTTP 状态码范围，如 200-299、201、2xx
+	CodePath      string   `yaml:"codePath"`      // 响应体中返回码的 JSON 路径，"-" 表示不检查
+	SuccessCodes  []string `yaml:"successCodes"`  // 表示成功的返回码
+	MessagePath   string   `yaml:"messagePath"`   // 响应信息的 JSON 路径
+	// 下游账号ID的来源：body 从 IDPath 读取，header 从 IDHeader 读取（URL 取最后一段），text 为整个响应体
+	IDFrom   string `yaml:"idFrom"`
+	IDPath   string `yaml:"idPath"`
+	IDHeader string `yaml:"idHeader"`
+	// 账号已存在的判定，命中时按账号查找已有的下游账号ID并视为成功
+	ExistsStatus []string `yaml:"existsStatus"`
+	ExistsCodes  []string `yaml:"existsCodes"`
+}
+
+// AuthConfig 出站请求认证，密钥可直接配置或从文件读取（*File 优先）
+type AuthConfig struct {
+	Type string `yaml:"type"` // none、bearer、basic、hmac、oauth2
+
+	// bearer
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"tokenFile"`
+
+	// basic
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"passwordFile"`
+
+	// hmac：对 方法、路径、时间戳、随机数和请求体摘要 签名
+	KeyID      string `yaml:"keyID"`
+	Secret     string `yaml:"secret"`
+	SecretFile string `yaml:"secretFile"`
+
+	// oauth2 client credentials，令牌缓存至过期前
+	TokenURL         string   `yaml:"tokenURL"`
+	ClientID         string   `yaml:"clientID"`
+	ClientSecret     string   `yaml:"clientSecret"`
+	ClientSecretFile string   `yaml:"clientSecretFile"`
+	Scopes           []string `yaml:"scopes"`
+}
+
+// MappingConfig 出站请求体的映射模板，见 pkg/mapping
+type MappingConfig struct {
+	Body   map[string]any            `yaml:"body"`   // 请求体模板，字符串值为 text/template
+	Tables map[string]map[string]any `yaml:"tables"` // lookup 码表，如性别代码
+}
+
+// SCIMConfig scim 连接器配置
+type SCIMConfig struct {
+	BaseURL string `yaml:"baseURL"` // SCIM 服务根地址（不含 /Users），为空时使用应用发布地址
+}
+
+// LDAPConfig ldap 连接器配置，用户条目创建在 BaseDN 下
+type LDAPConfig struct {
+	URL              string            `yaml:"url"` // ldap://host:389 或 ldaps://host:636
+	StartTLS         bool              `yaml:"startTLS"`
+	BindDN           string            `yaml:"bindDN"`
+	BindPassword     string            `yaml:"bindPassword"`
+	BindPasswordFile string            `yaml:"bindPasswordFile"` // 优先于 bindPassword
+	BaseDN           string            `yaml:"baseDN"`
+	RDNAttribute     string            `yaml:"rdnAttribute"`  // 条目 RDN 属性，默认 uid
+	ObjectClasses    []string          `yaml:"objectClasses"` // 默认 inetOrgPerson
+	Attributes       map[string]string `yaml:"attributes"`    // LDAP 属性 -> 用户字段，未配置时使用默认映射
+	// 停用时写入的属性和值，未配置时停用即删除条目
+	DisableAttribute string        `yaml:"disableAttribute"`
+	DisableValue     string        `yaml:"disableValue"`
+	Timeout          time.Duration `yaml:"timeout"`
+}
+
+// InterceptorConfig 单个拦截器的配置，未设置的字段使用拦截器自身的默认路由
+type InterceptorConfig struct {
+	Enabled     *bool  `yaml:"enabled"`
+	Method      string `yaml:"method"`
+	Path        string `yaml:"path"`
+	ContentType string `yaml:"contentType"`
+}
+
+// Default returns the built-in configuration, matching the previously hard-coded
+// values except for the jos credentials, which must be configured.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Listen:          ":8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    20 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Upstream: UpstreamConfig{
+			BaseURL:         "http://join-user-center:8084",
+			Timeout:         10 * time.Second,
+			MaxIdleConns:    100,
+			IdleConnTimeout: 90 * time.Second,
+			Response: UpstreamResponseConfig{
+				CodeField:    "code",
+				MessageField: "msg",
+				DataField:    "data",
+				SuccessCodes: []int{0, 200},
+			},
+		},
+		Jos: JosConfig{
+			Host:            "join-mysql-standalone-svc:3306",
+			Name:            "user_center_workspace",
+			MaxIdleConns:    10,
+			MaxOpenConns:    100,
+			ConnMaxLifetime: time.Hour,
+			LogLevel:        "info",
+			SlowThreshold:   time.Second,
+		},
+		State: StateConfig{
+			Driver:          StateDriverSQLite,
+			Path:            "./myapp.db",
+			MaxIdleConns:    10,
+			MaxOpenConns:    50,
+			ConnMaxLifetime: time.Hour,
+			LogLevel:        "info",
+			SlowThreshold:   time.Second,
+			AutoMigrate:     true,
+		},
+		SCIMServer: SCIMServerConfig{
+			MaxResults:      100,
+			MaxGroupMembers: 10000,
+		},
+		Downstream: DownstreamConfig{
+			Timeout:             10 * time.Second,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		Endpoints: EndpointConfig{
+			Prefer:        AddressInside,
+			Fallback:      true,
+			ProbeTimeout:  2 * time.Second,
+			ProbeInterval: 30 * time.Second,
+		},
+		Breaker: BreakerConfig{
+			Enabled:          true,
+			FailureThreshold: 5,
+			Cooldown:         30 * time.Second,
+			HalfOpenProbes:   1,
+		},
+		Outbox: OutboxConfig{
+			Workers:           4,
+			InlineConcurrency: 8,
+			PollInterval:      5 * time.Second,
+			BatchSize:         50,
+			MaxAttempts:       8,
+			BaseBackoff:       10 * time.Second,
+			MaxBackoff:        30 * time.Minute,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the config file, environment
+// variables and command line flags, in increasing order of precedence.
+func Load(args []string) (*Config, error) {
+	return LoadFlags(flag.NewFlagSet("proxy", flag.ContinueOnError), args)
+}
+
+// LoadFlags is Load with the caller's flag set, so that subcommands can
+// define their own flags next to the configuration flags.
+func LoadFlags(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg, err := load(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Jos.readPasswordFile(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadStateFlags is LoadFlags for commands that only open the proxy state
+// database, such as the migrate subcommands: it validates the state settings
+// and, only when withJos is set, reads and validates the jos settings.
+func LoadStateFlags(fs *flag.FlagSet, args []string, withJos bool) (*Config, error) {
+	cfg, err := load(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	validate := cfg.State.Validate()
+	if withJos {
+		if err := cfg.Jos.readPasswordFile(); err != nil {
+			return nil, err
+		}
+		validate = errors.Join(validate, cfg.Jos.Validate())
+	}
+	if validate != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", validate)
+	}
+	return cfg, nil
+}
+
+// load 按默认值、配置文件、环境变量、命令行参数的顺序构建配置，不做校验
+func load(fs *flag.FlagSet, args []string) (*Config, error) {
+	path := fs.String("config", "", "path to the YAML config file (env PROXY_CONFIG)")
+	listen := fs.String("listen", "", "listen address, e.g. :8080")
+	upstream := fs.String("upstream", "", "user center base URL")
+	josDSN := fs.String("jos-dsn", "", "jos MySQL DSN")
+	stateDriver := fs.String("state-driver", "", "proxy state database driver: sqlite, mysql or postgres")
+	statePath := fs.String("state-path", "", "proxy sqlite database path")
+	stateDSN := fs.String("state-dsn", "", "proxy state MySQL or Postgres DSN")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	// 显式指定的配置文件必须存在，默认路径不存在时忽略
+	file, explicit := *path, *path != ""
+	if !explicit {
+		if env, ok := os.LookupEnv("PROXY_CONFIG"); ok && env != "" {
+			file, explicit = env, true
+		} else {
+			file = DefaultPath
+		}
+	}
+	if err := cfg.loadFile(file, explicit); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			cfg.Server.Listen = *listen
+		case "upstream":
+			cfg.Upstream.BaseURL = *upstream
+		case "jos-dsn":
+			cfg.Jos.DSN = *josDSN
+		case "state-path":
+			cfg.State.Path = *statePath
+		case "state-driver":
+			cfg.State.Driver = *stateDriver
+		case "state-dsn":
+			cfg.State.DSN = *stateDSN
+		}
+	})
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// envBinding 环境变量到配置字段的映射
+type envBinding struct {
+	name  string
+	apply func(c *Config, v string) error
+}
+
+var envBindings = []envBinding{
+	{"PROXY_LISTEN", func(c *Config, v string) error { c.Server.Listen = v; return nil }},
+	{"PROXY_READ_TIMEOUT", durationEnv(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+	{"PROXY_WRITE_TIMEOUT", durationEnv(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+	{"PROXY_SHUTDOWN_TIMEOUT", durationEnv(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+	{"PROXY_UPSTREAM_URL", func(c *Config, v string) error { c.Upstream.BaseURL = v; return nil }},
+	{"PROXY_UPSTREAM_TIMEOUT", durationEnv(func(c *Config) *time.Duration { return &c.Upstream.Timeout })},
+	{"PROXY_UPSTREAM_MAX_IDLE_CONNS", intEnv(func(c *Config) *int { return &c.Upstream.MaxIdleConns })},
+	{"PROXY_JOS_DSN", func(c *Config, v string) error { c.Jos.DSN = v; return nil }},
+	{"PROXY_JOS_HOST", func(c *Config, v string) error { c.Jos.Host = v; return nil }},
+	{"PROXY_JOS_USER", func(c *Config, v string) error { c.Jos.User = v; return nil }},
+	{"PROXY_JOS_PASSWORD", func(c *Config, v string) error { c.Jos.Password = v; return nil }},
+	{"PROXY_JOS_PASSWORD_FILE", func(c *Config, v string) error { c.Jos.PasswordFile = v; return nil }},
+	{"PROXY_JOS_NAME", func(c *Config, v string) error { c.Jos.Name = v; return nil }},
+	{"PROXY_JOS_MAX_IDLE_CONNS", intEnv(func(c *Config) *int { return &c.Jos.MaxIdleConns })},
+	{"PROXY_JOS_MAX_OPEN_CONNS", intEnv(func(c *Config) *int { return &c.Jos.MaxOpenConns })},
+	{"PROXY_JOS_LOG_LEVEL", func(c *Config, v string) error { c.Jos.LogLevel = v; return nil }},
+	{"PROXY_STATE_DRIVER", func(c *Config, v string) error { c.State.Driver = v; return nil }},
+	{"PROXY_STATE_PATH", func(c *Config, v string) error { c.State.Path = v; return nil }},
+	{"PROXY_STATE_DSN", func(c *Config, v string) error { c.State.DSN = v; return nil }},
+	{"PROXY_STATE_MAX_OPEN_CONNS", intEnv(func(c *Config) *int { return &c.State.MaxOpenConns })},
+	{"PROXY_STATE_LOG_LEVEL", func(c *Config, v string) error { c.State.LogLevel = v; return nil }},
+	{"PROXY_STATE_AUTO_MIGRATE", boolEnv(func(c *Config) *bool { return &c.State.AutoMigrate })},
+	{"PROXY_SCIM_TOKEN", func(c *Config, v string) error { c.SCIMServer.BearerToken = v; return nil }},
+	{"PROXY_ADMIN_TOKEN", func(c *Config, v string) error { c.Admin.BearerToken = v; return nil }},
+	{"PROXY_DOWNSTREAM_TIMEOUT", durationEnv(func(c *Config) *time.Duration { return &c.Downstream.Timeout })},
+	{"PROXY_OUTBOX_WORKERS", intEnv(func(c *Config) *int { return &c.Outbox.Workers })},
+	{"PROXY_OUTBOX_INLINE_CONCURRENCY", intEnv(func(c *Config) *int { return &c.Outbox.InlineConcurrency })},
+	{"PROXY_OUTBOX_MAX_ATTEMPTS", intEnv(func(c *Config) *int { return &c.Outbox.MaxAttempts })},
+}
+
+func durationEnv(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+func intEnv(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func boolEnv(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func (c *Config) applyEnv() error {
+	var errs []error
+	for _, b := range envBindings {
+		v, ok := os.LookupEnv(b.name)
+		if !ok {
+			continue
+		}
+		if err := b.apply(c, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the configuration and reports every problem found.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Server.Listen == "" {
+		fail("server.listen must not be empty")
+	}
+	if c.Server.ReadTimeout <= 0 {
+		fail("server.readTimeout must be positive")
+	}
+	if c.Server.WriteTimeout <= 0 {
+		fail("server.writeTimeout must be positive")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdownTimeout must be positive")
+	}
+
+	if u, err := url.Parse(c.Upstream.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		fail("upstream.baseURL %q must be an absolute URL", c.Upstream.BaseURL)
+	}
+	if c.Upstream.Timeout <= 0 {
+		fail("upstream.timeout must be positive")
+	}
+	if c.Upstream.MaxIdleConns < 0 {
+		fail("upstream.maxIdleConns must not be negative")
+	}
+	if r := c.Upstream.Response; r.CodeField == "" || r.MessageField == "" || r.DataField == "" {
+		fail("upstream.response codeField, messageField and dataField must not be empty")
+	}
+	if len(c.Upstream.Response.SuccessCodes) == 0 {
+		fail("upstream.response.successCodes must not be empty")
+	}
+	if err := c.Upstream.TLS.Validate(); err != nil {
+		fail("upstream.tls: %w", err)
+	}
+
+	if err := c.Jos.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.State.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if c.Outbox.Workers <= 0 {
+		fail("outbox.workers must be positive")
+	}
+	if c.Outbox.InlineConcurrency <= 0 {
+		fail("outbox.inlineConcurrency must be positive")
+	}
+	if c.Outbox.PollInterval <= 0 {
+		fail("outbox.pollInterval must be positive")
+	}
+	if c.Outbox.BatchSize <= 0 {
+		fail("outbox.batchSize must be positive")
+	}
+	if c.Outbox.MaxAttempts <= 0 {
+		fail("outbox.maxAttempts must be positive")
+	}
+	if c.Outbox.BaseBackoff <= 0 || c.Outbox.MaxBackoff < c.Outbox.BaseBackoff {
+		fail("outbox.baseBackoff must be positive and not exceed outbox.maxBackoff")
+	}
+	if c.Outbox.RunningTimeout < 0 {
+		fail("outbox.runningTimeout must not be negative")
+	}
+	// 共享状态库时其他实例可能正在执行这些任务
+	if c.State.Driver != StateDriverSQLite && c.Outbox.RunningTimeout == 0 {
+		fail("outbox.runningTimeout must be set when state.driver is %s", c.State.Driver)
+	}
+
+	if c.SCIMServer.Enabled && c.SCIMServer.BearerToken == "" {
+		fail("scimServer.bearerToken must be set when scimServer is enabled")
+	}
+	if c.SCIMServer.MaxResults <= 0 {
+		fail("scimServer.maxResults must be positive")
+	}
+	if c.SCIMServer.MaxGroupMembers <= 0 {
+		fail("scimServer.maxGroupMembers must be positive")
+	}
+
+	if c.Downstream.Timeout <= 0 {
+		fail("downstream.timeout must be positive")
+	}
+	if err := validateTimeouts(c.Downstream.Timeouts); err != nil {
+		fail("downstream.timeouts: %w", err)
+	}
+	if c.Downstream.MaxIdleConns < 0 || c.Downstream.MaxIdleConnsPerHost < 0 {
+		fail("downstream pool sizes must not be negative")
+	}
+
+	if !validPrefer(c.Endpoints.Prefer) || c.Endpoints.Prefer == "" {
+		fail("endpoints.prefer %q must be inside or outside", c.Endpoints.Prefer)
+	}
+	if c.Endpoints.ProbeTimeout < 0 || c.Endpoints.ProbeInterval < 0 {
+		fail("endpoints.probeTimeout and endpoints.probeInterval must not be negative")
+	}
+	for envID, env := range c.Endpoints.Environments {
+		if !validPrefer(env.Prefer) {
+			fail("endpoints.environments.%d.prefer %q must be inside or outside", envID, env.Prefer)
+		}
+	}
+
+	if c.Breaker.FailureThreshold <= 0 || c.Breaker.HalfOpenProbes <= 0 {
+		fail("breaker.failureThreshold and breaker.halfOpenProbes must be positive")
+	}
+	if c.Breaker.Cooldown <= 0 {
+		fail("breaker.cooldown must be positive")
+	}
+	if c.Admin.Enabled && c.Admin.BearerToken == "" {
+		fail("admin.bearerToken must be set when admin is enabled")
+	}
+
+	for appID, app := range c.Apps {
+		if err := app.TLS.Validate(); err != nil {
+			fail("apps.%d.tls: %w", appID, err)
+		}
+		if app.Timeout < 0 {
+			fail("apps.%d.timeout must not be negative", appID)
+		}
+		if err := validateTimeouts(app.Timeouts); err != nil {
+			fail("apps.%d.timeouts: %w", appID, err)
+		}
+		if !validPrefer(app.Endpoint.Prefer) {
+			fail("apps.%d.endpoint.prefer %q must be inside or outside", appID, app.Endpoint.Prefer)
+		}
+		if app.Connector != "ldap" {
+			continue
+		}
+		if u, err := url.Parse(app.LDAP.URL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			fail("apps.%d.ldap.url %q must be an ldap:// or ldaps:// URL", appID, app.LDAP.URL)
+		}
+		if app.LDAP.BaseDN == "" {
+			fail("apps.%d.ldap.baseDN must not be empty", appID)
+		}
+		if app.LDAP.DisableValue != "" && app.LDAP.DisableAttribute == "" {
+			fail("apps.%d.ldap.disableValue requires disableAttribute", appID)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the jos database settings.
+func (c JosConfig) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	if c.DSN == "" && (c.Host == "" || c.User == "" || c.Name == "") {
+		fail("jos.dsn or jos.host, jos.user and jos.name must be set")
+	}
+	if c.DSN == "" && c.Password == "" {
+		fail("jos.password or jos.passwordFile must be set when jos.dsn is empty")
+	}
+	if c.MaxIdleConns < 0 || c.MaxOpenConns < 0 {
+		fail("jos pool sizes must not be negative")
+	}
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		fail("jos.maxIdleConns (%d) must not exceed jos.maxOpenConns (%d)", c.MaxIdleConns, c.MaxOpenConns)
+	}
+	if !validLogLevel(c.LogLevel) {
+		fail("jos.logLevel %q must be one of silent, error, warn, info", c.LogLevel)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the proxy state database settings.
+func (c StateConfig) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	switch c.Driver {
+	case StateDriverSQLite:
+		if c.Path == "" {
+			fail("state.path must not be empty")
+		}
+	case StateDriverMySQL, StateDriverPostgres:
+		if c.DSN == "" {
+			fail("state.dsn must be set for the %s driver", c.Driver)
+		}
+	default:
+		fail("state.driver %q must be one of %s, %s, %s", c.Driver, StateDriverSQLite, StateDriverMySQL, StateDriverPostgres)
+	}
+	if c.MaxIdleConns < 0 || c.MaxOpenConns < 0 {
+		fail("state pool sizes must not be negative")
+	}
+	if !validLogLevel(c.LogLevel) {
+		fail("state.logLevel %q must be one of silent, error, warn, info", c.LogLevel)
+	}
+	return errors.Join(errs...)
+}
+
+// validateTimeouts 检查按操作配置的超时
+func validateTimeouts(timeouts map[string]time.Duration) error {
+	var errs []error
+	for _, op := range slices.Sorted(maps.Keys(timeouts)) {
+		if d := timeouts[op]; !slices.Contains(Operations, op) {
+			errs = append(errs, fmt.Errorf("unknown operation %q (available: %s)", op, strings.Join(Operations, ", ")))
+		} else if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", op))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validPrefer 优先地址为空（沿用上一级）、inside 或 outside
+func validPrefer(prefer string) bool {
+	return prefer == "" || prefer == AddressInside || prefer == AddressOutside
+}
+
+func validLogLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "silent", "error", "warn", "info":
+		return true
+	}
+	return false
+}
+
+// readPasswordFile 读取 passwordFile，文件内容优先于 password
+func (c *JosConfig) readPasswordFile() error {
+	if c.PasswordFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("failed to read jos.passwordFile: %w", err)
+	}
+	c.Password = strings.TrimSpace(string(data))
+	return nil
+}
+
+// MySQLDSN returns the jos DSN, building it from its parts when no DSN is configured.
+func (c JosConfig) MySQLDSN() string {
+	if c.DSN != "" {
+		return c.DSN
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		c.User, c.Password, c.Host, c.Name)
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadJosCredentials(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "jos-password")
+	if err := os.WriteFile(secret, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name     string
+		env      map[string]string
+		password string
+		err      string
+	}{
+		{"missing", nil, "", "jos.user"},
+		{"missing password", map[string]string{"PROXY_JOS_USER": "proxy"}, "", "jos.password"},
+		{"env", map[string]string{"PROXY_JOS_USER": "proxy", "PROXY_JOS_PASSWORD": "from-env"}, "from-env", ""},
+		{"file", map[string]string{"PROXY_JOS_USER": "proxy", "PROXY_JOS_PASSWORD": "from-env", "PROXY_JOS_PASSWORD_FILE": secret}, "from-file", ""},
+		{"dsn", map[string]string{"PROXY_JOS_DSN": "proxy:secret@tcp(db:3306)/jos"}, "", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("PROXY_CONFIG", "")
+			for _, name := range []string{"PROXY_JOS_DSN", "PROXY_JOS_USER", "PROXY_JOS_PASSWORD", "PROXY_JOS_PASSWORD_FILE"} {
+				t.Setenv(name, tc.env[name])
+				if _, ok := tc.env[name]; !ok {
+					os.Unsetenv(name)
+				}
+			}
+			cfg, err := Load(nil)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Load() error = %v, want one mentioning %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Jos.Password != tc.password {
+				t.Errorf("jos password = %q, want %q", cfg.Jos.Password, tc.password)
+			}
+		})
+	}
+}
+
+func TestLoadUpstreamResponse(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	body := "jos: {dsn: \"proxy:secret@tcp(db:3306)/jos\"}\nupstream:\n  response:\n    codeField: status\n    successCodes: [1]\n"
+	if err := os.WriteFile(file, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PROXY_CONFIG", file)
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 未配置的字段保留默认值，成功码整体替换
+	r := cfg.Upstream.Response
+	if r.CodeField != "status" || r.MessageField != "msg" || r.DataField != "data" || len(r.SuccessCodes) != 1 || r.SuccessCodes[0] != 1 {
+		t.Errorf("upstream response = %+v", r)
+	}
+
+	if err := os.WriteFile(file, []byte(strings.Replace(body, "[1]", "[]", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "successCodes") {
+		t.Errorf("Load() with no success codes error = %v", err)
+	}
+}
+
+func TestLoadStateFlags(t *testing.T) {
+	t.Setenv("PROXY_CONFIG", "")
+	for _, name := range []string{"PROXY_JOS_DSN", "PROXY_JOS_USER", "PROXY_JOS_PASSWORD", "PROXY_JOS_PASSWORD_FILE"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+	t.Setenv("PROXY_UPSTREAM_URL", "not a url")
+
+	// 只校验状态库配置，无需用户中心库账号
+	cfg, err := LoadStateFlags(flag.NewFlagSet("migrate", flag.ContinueOnError), []string{"-state-path", "state.db"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.State.Path != "state.db" {
+		t.Errorf("state path = %q", cfg.State.Path)
+	}
+	if _, err := LoadStateFlags(flag.NewFlagSet("migrate", flag.ContinueOnError), []string{"-state-driver", "mysql"}, false); err == nil || !strings.Contains(err.Error(), "state.dsn") {
+		t.Errorf("LoadStateFlags() without a state DSN error = %v", err)
+	}
+	if _, err := LoadStateFlags(flag.NewFlagSet("migrate", flag.ContinueOnError), nil, true); err == nil || !strings.Contains(err.Error(), "jos.user") || strings.Contains(err.Error(), "upstream") {
+		t.Errorf("LoadStateFlags() with jos error = %v, want only the jos settings checked", err)
+	}
+}
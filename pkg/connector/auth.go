@@ -0,0 +1,160 @@
+package connector
+
+import (
+	"center/pkg/config"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// 出站认证方式
+const (
+	authNone   = "none"
+	authBearer = "bearer"
+	authBasic  = "basic"
+	authHMAC   = "hmac"
+	authOAuth2 = "oauth2"
+)
+
+// HMAC 签名请求头
+const (
+	headerSignature = "X-Signature"
+	headerKeyID     = "X-Signature-Key-Id"
+	headerTimestamp = "X-Signature-Timestamp"
+	headerNonce     = "X-Signature-Nonce"
+)
+
+// newHTTPClient creates the client for an app's downstream calls over base,
+// adding the configured authentication to every request. OAuth2 tokens are
+// fetched over base as well, each fetch bounded by timeout.
+func newHTTPClient(cfg config.AuthConfig, base http.RoundTripper, timeout time.Duration) (*http.Client, error) {
+	switch cfg.Type {
+	case "", authNone:
+		return &http.Client{Transport: base}, nil
+	case authBearer:
+		token, err := readSecret("token", cfg.Token, cfg.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Client{Transport: headerTransport{base: base, set: func(h http.Header) {
+			h.Set("Authorization", "Bearer "+token)
+		}}}, nil
+	case authBasic:
+		password, err := readSecret("password", cfg.Password, cfg.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Username == "" {
+			return nil, fmt.Errorf("basic auth requires username")
+		}
+		return &http.Client{Transport: headerTransport{base: base, set: func(h http.Header) {
+			r := http.Request{Header: h}
+			r.SetBasicAuth(cfg.Username, password)
+		}}}, nil
+	case authHMAC:
+		secret, err := readSecret("secret", cfg.Secret, cfg.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		return &http.Client{Transport: hmacTransport{base: base, keyID: cfg.KeyID, secret: []byte(secret)}}, nil
+	case authOAuth2:
+		secret, err := readSecret("clientSecret", cfg.ClientSecret, cfg.ClientSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.TokenURL == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("oauth2 auth requires tokenURL and clientID")
+		}
+		cc := clientcredentials.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: secret,
+			TokenURL:     cfg.TokenURL,
+			Scopes:       cfg.Scopes,
+		}
+		// 令牌请求使用应用的 TLS 设置；TokenSource 缓存令牌，过期前复用
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: base, Timeout: timeout})
+		return &http.Client{Transport: &oauth2.Transport{Source: cc.TokenSource(ctx), Base: base}}, nil
+	}
+	return nil, fmt.Errorf("unknown auth type %q (available: none, bearer, basic, hmac, oauth2)", cfg.Type)
+}
+
+// readSecret 读取密钥，配置了文件时以文件内容为准
+func readSecret(name, value, file string) (string, error) {
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s file: %w", name, err)
+		}
+		value = strings.TrimSpace(string(data))
+	}
+	if value == "" {
+		return "", fmt.Errorf("%s must be set", name)
+	}
+	return value, nil
+}
+
+// headerTransport 为每个请求设置认证头
+type headerTransport struct {
+	base http.RoundTripper
+	set  func(h http.Header)
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	t.set(req.Header)
+	return t.base.RoundTrip(req)
+}
+
+// hmacTransport 以 HMAC-SHA256 签名请求：
+// hex(HMAC(secret, METHOD \n /path?query \n timestamp \n nonce \n hex(sha256(body))))
+type hmacTransport struct {
+	base   http.RoundTripper
+	keyID  string
+	secret []byte
+}
+
+func (t hmacTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	bodyHash := sha256.New()
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body for signing: %w", err)
+		}
+		_, err = io.Copy(bodyHash, body)
+		body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read body for signing: %w", err)
+		}
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+
+	mac := hmac.New(sha256.New, t.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", req.Method, req.URL.RequestURI(), timestamp, nonceHex, hex.EncodeToString(bodyHash.Sum(nil)))
+
+	req = req.Clone(req.Context())
+	if t.keyID != "" {
+		req.Header.Set(headerKeyID, t.keyID)
+	}
+	req.Header.Set(headerTimestamp, timestamp)
+	req.Header.Set(headerNonce, nonceHex)
+	req.Header.Set(headerSignature, hex.EncodeToString(mac.Sum(nil)))
+	return t.base.RoundTrip(req)
+}
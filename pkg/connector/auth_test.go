@@ -0,0 +1,37 @@
+package connector
+
+import (
+	"center/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOAuth2TokenUsesAppTransport(t *testing.T) {
+	// 自签名证书只有应用的传输层信任，令牌请求走默认客户端时会失败
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"access_token":"abc","token_type":"Bearer","expires_in":3600}`))
+		case "/users":
+			if got := r.Header.Get("Authorization"); got != "Bearer abc" {
+				t.Errorf("Authorization = %q", got)
+			}
+		}
+	}))
+	defer server.Close()
+
+	client, err := newHTTPClient(config.AuthConfig{
+		Type: authOAuth2, TokenURL: server.URL + "/token", ClientID: "proxy", ClientSecret: "secret",
+	}, server.Client().Transport, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL + "/users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
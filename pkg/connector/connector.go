@@ -0,0 +1,287 @@
+package connector
+
+import (
+	"center/pkg/config"
+	"center/pkg/mapping"
+	"center/pkg/tlsutil"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultName 未配置连接器的应用使用的连接器
+const DefaultName = "default"
+
+// ErrNotFound Lookup 未找到下游账号
+var ErrNotFound = errors.New("account not found")
+
+// ErrUnavailable 下游不可达：网络错误、超时或服务端错误，熔断器以此计数
+var ErrUnavailable = errors.New("app unavailable")
+
+// unavailableError 标记下游不可达的错误，同时匹配原错误和 ErrUnavailable
+type unavailableError struct{ err error }
+
+func (e *unavailableError) Error() string   { return e.err.Error() }
+func (e *unavailableError) Unwrap() []error { return []error{e.err, ErrUnavailable} }
+
+// unavailable 将错误标记为下游不可达
+func unavailable(err error) error {
+	return &unavailableError{err: err}
+}
+
+// User 同步到下游应用的用户资料
+type User struct {
+	UserName string `json:"userName"`
+	Name     string `json:"name"`
+	Mobile   string `json:"mobile"`
+	Email    string `json:"email"`
+	Gender   int    `json:"gender"`
+	NickName string `json:"nickName"`
+	Code     string `json:"code"`
+	Avatar   string `json:"avatar"`
+	Address  string `json:"address"`
+	TenantID string `json:"tenantId"`
+}
+
+// Fields returns the user fields keyed by their JSON names, the data that
+// mapping templates and attribute mappings refer to.
+func (u User) Fields() map[string]any {
+	return map[string]any{
+		"userName": u.UserName,
+		"name":     u.Name,
+		"mobile":   u.Mobile,
+		"email":    u.Email,
+		"gender":   u.Gender,
+		"nickName": u.NickName,
+		"code":     u.Code,
+		"avatar":   u.Avatar,
+		"address":  u.Address,
+		"tenantId": u.TenantID,
+	}
+}
+
+// Result 下游调用结果，RemoteID 为下游账号ID
+type Result struct {
+	RemoteID string
+	Code     int
+	Message  string
+	Deleted  bool // 不支持停用的协议以删除代替停用时为 true
+}
+
+// Connector 下游应用的用户开通协议
+type Connector interface {
+	Create(ctx context.Context, user User) (Result, error)
+	Update(ctx context.Context, remoteID string, user User) (Result, error)
+	Disable(ctx context.Context, remoteID string) (Result, error)
+	Delete(ctx context.Context, remoteID string) (Result, error)
+	// Lookup 按账号查找下游用户，不存在时返回 ErrNotFound
+	Lookup(ctx context.Context, userName string) (Result, error)
+}
+
+// App 创建连接器所需的应用信息
+type App struct {
+	AppID   uint64
+	Address string
+	Config  config.AppConfig
+	Mapping *mapping.Template // 出站请求体模板，未配置时为 nil
+	Client  *http.Client      // 带应用认证的 HTTP 客户端
+}
+
+// Factory 按应用创建连接器
+type Factory func(app App) (Connector, error)
+
+var (
+	mu         sync.RWMutex
+	factories  = make(map[string]Factory)
+	downstream = config.DownstreamConfig{Timeout: defaultTimeout}
+	apps       map[uint64]config.AppConfig
+	mappings   map[uint64]*mapping.Template
+	clients    map[uint64]*http.Client
+
+	// defaultClient 未配置认证和 TLS 的应用共用的客户端，使用共享连接池
+	defaultClient = &http.Client{}
+)
+
+// defaultTimeout Init 之前使用的下游调用超时
+const defaultTimeout = 10 * time.Second
+
+// Register makes a connector available under name. It panics if the name is
+// registered twice.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := factories[name]; dup {
+		panic("connector: Register called twice for " + name)
+	}
+	factories[name] = factory
+}
+
+// Init sets the downstream timeouts and connection pool and the per-app
+// configuration, keyed by jos_app.app_id, checks that every configured
+// connector exists and compiles the mapping templates. Apps without their own
+// TLS settings share one pooled transport.
+func Init(down config.DownstreamConfig, cfg map[uint64]config.AppConfig) error {
+	mu.Lock()
+	defer mu.Unlock()
+	var errs []error
+	compiled := make(map[uint64]*mapping.Template)
+	appClients := make(map[uint64]*http.Client)
+	newBase := newTransport(down)
+	shared := newBase()
+	for appID, app := range cfg {
+		name := connectorName(app)
+		if _, ok := factories[name]; !ok {
+			errs = append(errs, fmt.Errorf("apps.%d: unknown connector %q (available: %s)", appID, name, strings.Join(names(), ", ")))
+		}
+		var transport http.RoundTripper = shared
+		if tlsutil.Configured(app.TLS) {
+			var err error
+			if transport, err = tlsutil.NewTransport(app.TLS, newBase); err != nil {
+				errs = append(errs, fmt.Errorf("apps.%d.tls: %w", appID, err))
+				continue
+			}
+		}
+		tokenTimeout := app.Timeout
+		if tokenTimeout <= 0 {
+			tokenTimeout = down.Timeout
+		}
+		if tokenTimeout <= 0 {
+			tokenTimeout = defaultTimeout
+		}
+		client, err := newHTTPClient(app.Auth, transport, tokenTimeout)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("apps.%d.auth: %w", appID, err))
+		}
+		appClients[appID] = client
+		if name == DefaultName {
+			if _, err := newResponseCriteria(app.Response); err != nil {
+				errs = append(errs, fmt.Errorf("apps.%d.response: %w", appID, err))
+			}
+		}
+		if len(app.Mapping.Body) == 0 {
+			continue
+		}
+		tmpl, err := compileMapping(app.Mapping)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("apps.%d.mapping: %w", appID, err))
+			continue
+		}
+		compiled[appID] = tmpl
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	downstream, apps, mappings, clients = down, cfg, compiled, appClients
+	defaultClient = &http.Client{Transport: shared}
+	return nil
+}
+
+// newTransport 按连接池配置创建下游 HTTP 连接使用的 Transport
+func newTransport(cfg config.DownstreamConfig) func() *http.Transport {
+	return func() *http.Transport {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.MaxIdleConns = cfg.MaxIdleConns
+		t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+		t.IdleConnTimeout = cfg.IdleConnTimeout
+		return t
+	}
+}
+
+// compileMapping compiles the template and renders it once with an empty user
+// so that unknown fields and lookup tables are reported at startup.
+func compileMapping(cfg config.MappingConfig) (*mapping.Template, error) {
+	tmpl, err := mapping.Compile(cfg.Body, cfg.Tables)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tmpl.Render(User{}.Fields()); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// ForApp returns the connector configured for the app, the default connector
+// if none is configured.
+func ForApp(appID uint64, address string) (Connector, error) {
+	mu.RLock()
+	cfg, tmpl, client := apps[appID], mappings[appID], clients[appID]
+	factory, ok := factories[connectorName(cfg)]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown connector %q for app %d", connectorName(cfg), appID)
+	}
+	if client == nil {
+		client = defaultClient
+	}
+	conn, err := factory(App{AppID: appID, Address: address, Config: cfg, Mapping: tmpl, Client: client})
+	if err != nil {
+		return nil, err
+	}
+	return timedConnector{conn: conn, appID: appID}, nil
+}
+
+// Timeout returns the deadline of one operation on the app: the first one set
+// of the app's per-operation timeout, the app timeout, the downstream
+// per-operation timeout and the downstream timeout.
+func Timeout(appID uint64, op string) time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+	app := apps[appID]
+	for _, d := range []time.Duration{app.Timeouts[op], app.Timeout, downstream.Timeouts[op]} {
+		if d > 0 {
+			return d
+		}
+	}
+	return downstream.Timeout
+}
+
+// LookupBeforeCreate reports whether a create for the app should first look up
+// an existing downstream account: by default for every connector but the
+// default one, whose apps may only offer POST.
+func LookupBeforeCreate(appID uint64) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	app := apps[appID]
+	if app.Lookup == nil {
+		// default 连接器的查找接口需应用显式开启
+		return connectorName(app) != DefaultName
+	}
+	return *app.Lookup
+}
+
+// idempotencyKeyCtx 上下文中的幂等键
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey returns a context carrying the idempotency key that HTTP
+// connectors send downstream in the Idempotency-Key header.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// setIdempotencyKey 请求上下文中有幂等键时写入请求头
+func setIdempotencyKey(req *http.Request) {
+	if key, ok := req.Context().Value(idempotencyKeyCtx{}).(string); ok && key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+}
+
+func connectorName(cfg config.AppConfig) string {
+	if cfg.Connector == "" {
+		return DefaultName
+	}
+	return cfg.Connector
+}
+
+func names() []string {
+	list := make([]string, 0, len(factories))
+	for name := range factories {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
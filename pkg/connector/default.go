@@ -0,0 +1,233 @@
+package connector
+
+import (
+	"bytes"
+	"center/pkg/config"
+	"center/pkg/mapping"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+const contentTypeJSON = "application/json"
+
+func init() {
+	Register(DefaultName, func(app App) (Connector, error) {
+		if app.Address == "" {
+			return nil, fmt.Errorf("app %d has no address", app.AppID)
+		}
+		criteria, err := newResponseCriteria(app.Config.Response)
+		if err != nil {
+			return nil, fmt.Errorf("app %d response: %w", app.AppID, err)
+		}
+		return &defaultConnector{address: app.Address, cfg: app.Config.Default, mapping: app.Mapping, criteria: criteria, client: app.Client}, nil
+	})
+}
+
+// 请求体结构
+type UserSyncRequest struct {
+	UserName string `json:"userName"`
+	Name     string `json:"name"`
+	Phone    string `json:"phone"`
+	Email    string `json:"email"`
+	Sex      int    `json:"sex"`
+}
+
+// 响应体结构
+type Response struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Data    []AppUserData `json:"data"`
+}
+
+type AppUserData struct {
+	UserName string `json:"userName"`
+	UserID   string `json:"userId"`
+}
+
+// defaultConnector 应用自定义的用户接口：POST {address} 创建；
+// 应用开启时 PUT {address}/{id} 更新，DELETE {address}/{id} 删除，GET {address}?userName= 查找。
+// 响应默认为 {"code":1,"message":"","data":[{"userName","userId"}]}，成功判定和ID位置可按应用配置
+type defaultConnector struct {
+	address  string
+	cfg      config.DefaultConnectorConfig
+	mapping  *mapping.Template // 配置了映射模板时替代 UserSyncRequest
+	criteria *responseCriteria
+	client   *http.Client
+}
+
+// body 创建和更新的请求体
+func (c *defaultConnector) body(user User) (any, error) {
+	if c.mapping == nil {
+		return UserSyncRequest{
+			UserName: user.UserName,
+			Name:     user.Name,
+			Phone:    user.Mobile,
+			Email:    user.Email,
+			Sex:      user.Gender,
+		}, nil
+	}
+	body, err := c.mapping.Render(user.Fields())
+	if err != nil {
+		return nil, fmt.Errorf("failed to map user %s: %w", user.UserName, err)
+	}
+	return body, nil
+}
+
+// Create 创建下游账号，下游返回账号已存在时查找已有的账号ID
+func (c *defaultConnector) Create(ctx context.Context, user User) (Result, error) {
+	body, err := c.body(user)
+	if err != nil {
+		return Result{}, err
+	}
+	out, err := c.call(ctx, http.MethodPost, c.address, body)
+	if err != nil {
+		return out.Result, err
+	}
+	if out.exists {
+		existing, err := c.Lookup(ctx, user.UserName)
+		if err != nil {
+			return out.Result, fmt.Errorf("user %s already exists but was not found: %w", user.UserName, err)
+		}
+		out.RemoteID, out.Message = existing.RemoteID, "already exists"
+		return out.Result, nil
+	}
+	if out.RemoteID == "" {
+		return out.Result, fmt.Errorf("no user ID in response to create %s", user.UserName)
+	}
+	return out.Result, nil
+}
+
+// Update 未开启更新接口时与原协议相同，以 POST 重新提交用户，账号已存在也视为成功
+func (c *defaultConnector) Update(ctx context.Context, remoteID string, user User) (Result, error) {
+	body, err := c.body(user)
+	if err != nil {
+		return Result{}, err
+	}
+	if !c.cfg.Update {
+		out, err := c.call(ctx, http.MethodPost, c.address, body)
+		if err != nil {
+			return out.Result, err
+		}
+		if out.RemoteID == "" || out.exists {
+			out.RemoteID = remoteID
+		}
+		return out.Result, nil
+	}
+	target, err := url.JoinPath(c.address, remoteID)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid app address %s: %w", c.address, err)
+	}
+	return c.operation(ctx, http.MethodPut, target, body)
+}
+
+// Disable 该协议没有禁用接口，与删除相同，重新启用时重新创建
+func (c *defaultConnector) Disable(ctx context.Context, remoteID string) (Result, error) {
+	result, err := c.Delete(ctx, remoteID)
+	result.Deleted = c.cfg.Delete
+	return result, err
+}
+
+// Delete 未开启删除接口时不调用下游，下游账号保留
+func (c *defaultConnector) Delete(ctx context.Context, remoteID string) (Result, error) {
+	if !c.cfg.Delete {
+		log.Printf("App at %s has no delete endpoint, leaving account %s in place", c.address, remoteID)
+		return Result{Message: "delete not supported by app"}, nil
+	}
+	target, err := url.JoinPath(c.address, remoteID)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid app address %s: %w", c.address, err)
+	}
+	return c.operation(ctx, http.MethodDelete, target, nil)
+}
+
+func (c *defaultConnector) Lookup(ctx context.Context, userName string) (Result, error) {
+	target, err := url.Parse(c.address)
+	if err != nil {
+		return Result{}, fmt.Errorf("invalid app address %s: %w", c.address, err)
+	}
+	query := target.Query()
+	query.Set("userName", userName)
+	target.RawQuery = query.Encode()
+
+	resp, body, err := c.send(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return Result{}, err
+	}
+	// 只提供 POST 接口的应用不支持查询，按未找到处理后直接创建
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return Result{Code: resp.StatusCode, Message: resp.Status}, ErrNotFound
+	}
+	out, err := c.criteria.evaluate(resp, body)
+	if err != nil {
+		return out.Result, err
+	}
+	// 非 JSON 响应（如 HTML 页面）说明应用没有查找接口，按未找到处理
+	var response Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		return out.Result, ErrNotFound
+	}
+	result := Result{Code: out.Code, Message: out.Message}
+	for _, data := range response.Data {
+		if data.UserName == userName {
+			result.RemoteID = data.UserID
+			return result, nil
+		}
+	}
+	return result, ErrNotFound
+}
+
+// operation 调用 update/delete 接口，按应用的响应判定检查结果
+func (c *defaultConnector) operation(ctx context.Context, method, target string, payload any) (Result, error) {
+	out, err := c.call(ctx, method, target, payload)
+	if err == nil && out.exists {
+		err = fmt.Errorf("%s %s returned user already exists: %s", method, target, out.Message)
+	}
+	return out.Result, err
+}
+
+// call 发送请求并按应用的响应判定检查结果
+func (c *defaultConnector) call(ctx context.Context, method, target string, payload any) (responseOutcome, error) {
+	resp, body, err := c.send(ctx, method, target, payload)
+	if err != nil {
+		return responseOutcome{}, err
+	}
+	return c.criteria.evaluate(resp, body)
+}
+
+func (c *defaultConnector) send(ctx context.Context, method, target string, payload any) (*http.Response, []byte, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		jsonData, err := json.Marshal(payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal user data: %w", err)
+		}
+		reqBody = bytes.NewBuffer(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", contentTypeJSON)
+	}
+	req.Header.Set("Accept", contentTypeJSON)
+	setIdempotencyKey(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, unavailable(fmt.Errorf("failed to send request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, unavailable(fmt.Errorf("failed to read response body: %w", err))
+	}
+	return resp, body, nil
+}
@@ -0,0 +1,122 @@
+package connector
+
+import (
+	"center/pkg/config"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func newTestDefault(t *testing.T, handler http.HandlerFunc) Connector {
+	t.Helper()
+	return newTestDefaultConfig(t, config.AppConfig{}, handler)
+}
+
+func newTestDefaultConfig(t *testing.T, cfg config.AppConfig, handler http.HandlerFunc) Connector {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	conn, err := factories[DefaultName](App{AppID: 1, Address: server.URL + "/users", Config: cfg, Client: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestDefaultLookup(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status int
+		body   string
+		want   string
+		err    error
+	}{
+		{"found", http.StatusOK, `{"code":1,"data":[{"userName":"other","userId":"1"},{"userName":"alice","userId":"42"}]}`, "42", nil},
+		{"not in list", http.StatusOK, `{"code":1,"data":[]}`, "", ErrNotFound},
+		{"no lookup endpoint", http.StatusNotFound, `not found`, "", ErrNotFound},
+		{"post only", http.StatusMethodNotAllowed, ``, "", ErrNotFound},
+		{"html page", http.StatusOK, `<html>users</html>`, "", ErrNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := newTestDefault(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet || r.URL.Query().Get("userName") != "alice" {
+					t.Errorf("lookup request %s %s", r.Method, r.URL)
+				}
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			})
+			result, err := conn.Lookup(context.Background(), "alice")
+			if !errors.Is(err, tc.err) || result.RemoteID != tc.want {
+				t.Errorf("Lookup() = %q, %v, want %q, %v", result.RemoteID, err, tc.want, tc.err)
+			}
+		})
+	}
+
+	conn := newTestDefault(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	if _, err := conn.Lookup(context.Background(), "alice"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Lookup() on 502 = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestDefaultPostOnly(t *testing.T) {
+	var requests []string
+	conn := newTestDefault(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"code":1,"data":[]}`))
+	})
+	ctx := context.Background()
+	// 未开启更新接口时以 POST 重新提交，保留原账号ID
+	result, err := conn.Update(ctx, "42", User{UserName: "alice"})
+	if err != nil || result.RemoteID != "42" {
+		t.Errorf("Update() = %+v, %v", result, err)
+	}
+	if result, err := conn.Disable(ctx, "42"); err != nil || result.Deleted {
+		t.Errorf("Disable() = %+v, %v, want the account kept", result, err)
+	}
+	if _, err := conn.Delete(ctx, "42"); err != nil {
+		t.Errorf("Delete() = %v", err)
+	}
+	if want := []string{"POST /users"}; !slices.Equal(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestDefaultUpdateDelete(t *testing.T) {
+	var requests []string
+	conn := newTestDefaultConfig(t, config.AppConfig{Default: config.DefaultConnectorConfig{Update: true, Delete: true}}, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"code":1}`))
+	})
+	ctx := context.Background()
+	if _, err := conn.Update(ctx, "42", User{UserName: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := conn.Disable(ctx, "42"); err != nil || !result.Deleted {
+		t.Errorf("Disable() = %+v, %v, want the account deleted", result, err)
+	}
+	if want := []string{"PUT /users/42", "DELETE /users/42"}; !slices.Equal(requests, want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
+
+func TestLookupBeforeCreate(t *testing.T) {
+	on := true
+	if err := Init(config.DownstreamConfig{}, map[uint64]config.AppConfig{
+		1: {},
+		2: {Lookup: &on},
+		3: {Connector: "scim"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Init(config.DownstreamConfig{}, nil) })
+	for appID, want := range map[uint64]bool{1: false, 2: true, 3: true} {
+		if got := LookupBeforeCreate(appID); got != want {
+			t.Errorf("LookupBeforeCreate(%d) = %v, want %v", appID, got, want)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package connector
+
+import (
+	"center/pkg/config"
+	"center/pkg/tlsutil"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldap 连接器默认配置
+const (
+	defaultLDAPRDNAttribute = "uid"
+	defaultLDAPTimeout      = 10 * time.Second
+)
+
+var (
+	defaultLDAPObjectClasses = []string{"top", "person", "organizationalPerson", "inetOrgPerson"}
+
+	// defaultLDAPAttributes 默认的 LDAP 属性 -> 用户字段映射
+	defaultLDAPAttributes = map[string]string{
+		"uid":         "userName",
+		"cn":          "name",
+		"sn":          "name",
+		"displayName": "name",
+		"mail":        "email",
+		"mobile":      "mobile",
+	}
+
+	// ldapNamingAttributes person 类必填的属性，用户字段为空时用账号填充
+	ldapNamingAttributes = []string{"cn", "sn"}
+)
+
+// ldapClient 连接器使用的 LDAP 操作，*ldap.Conn 实现该接口
+type ldapClient interface {
+	Bind(username, password string) error
+	Add(req *ldap.AddRequest) error
+	Modify(req *ldap.ModifyRequest) error
+	ModifyDN(req *ldap.ModifyDNRequest) error
+	Del(req *ldap.DelRequest) error
+	Search(req *ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// dialLDAP 建立到目录服务器的连接，可替换为进程内的测试服务器
+var dialLDAP = func(cfg config.LDAPConfig, tlsCfg *tls.Config) (ldapClient, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName = u.Hostname()
+	}
+	conn, err := ldap.DialURL(cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: cfg.Timeout}), ldap.DialWithTLSConfig(tlsCfg))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(cfg.Timeout)
+	if cfg.StartTLS {
+		if err := conn.StartTLS(tlsCfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func init() {
+	Register("ldap", func(app App) (Connector, error) {
+		cfg := app.Config.LDAP
+		if cfg.URL == "" || cfg.BaseDN == "" {
+			return nil, fmt.Errorf("app %d has no LDAP url or baseDN", app.AppID)
+		}
+		if cfg.RDNAttribute == "" {
+			cfg.RDNAttribute = defaultLDAPRDNAttribute
+		}
+		if len(cfg.ObjectClasses) == 0 {
+			cfg.ObjectClasses = defaultLDAPObjectClasses
+		}
+		if len(cfg.Attributes) == 0 {
+			cfg.Attributes = defaultLDAPAttributes
+		}
+		fields := User{}.Fields()
+		for attr, field := range cfg.Attributes {
+			if _, ok := fields[field]; !ok {
+				return nil, fmt.Errorf("app %d maps LDAP attribute %s to unknown user field %q", app.AppID, attr, field)
+			}
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = defaultLDAPTimeout
+		}
+		return &ldapConnector{cfg: cfg, tls: app.Config.TLS}, nil
+	})
+}
+
+// ldapConnector 在应用的 BaseDN 下增删改用户条目，RemoteID 为条目 DN
+type ldapConnector struct {
+	cfg config.LDAPConfig
+	tls config.TLSConfig
+}
+
+// Create 以 RDN 属性=账号 在 BaseDN 下添加条目，条目已存在时更新该条目并恢复停用
+func (c *ldapConnector) Create(ctx context.Context, user User) (Result, error) {
+	dn := c.userDN(user.UserName)
+	req := ldap.NewAddRequest(dn, nil)
+	req.Attribute("objectClass", c.cfg.ObjectClasses)
+	req.Attribute(c.cfg.RDNAttribute, []string{user.UserName})
+
+	attrs := c.attributes(user)
+	for _, name := range ldapNamingAttributes {
+		if _, mapped := attrs[name]; mapped && attrs[name] == "" {
+			attrs[name] = user.UserName
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(attrs)) {
+		if name != c.cfg.RDNAttribute && attrs[name] != "" {
+			req.Attribute(name, []string{attrs[name]})
+		}
+	}
+
+	result, err := c.do(ctx, "add", func(conn ldapClient) error { return conn.Add(req) })
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultEntryAlreadyExists) {
+		// 条目已存在，沿用已有条目；该条目可能是之前停用的账号
+		result, err = c.Update(ctx, dn, user)
+		if err == nil {
+			result.Message = "already exists"
+		}
+		return result, err
+	}
+	if err != nil {
+		return result, err
+	}
+	result.RemoteID = dn
+	return result, nil
+}
+
+// Update 替换映射的属性，空值删除属性，并删除停用属性恢复已停用的条目；
+// 账号变化时先将条目改名为新的 RDN，Result.RemoteID 为改名后的 DN
+func (c *ldapConnector) Update(ctx context.Context, remoteID string, user User) (Result, error) {
+	dn, err := ldap.ParseDN(remoteID)
+	if err != nil || len(dn.RDNs) == 0 {
+		return Result{}, fmt.Errorf("invalid entry DN %q: %w", remoteID, err)
+	}
+	rdn := c.rdn(user.UserName)
+	renamed := !dn.RDNs[0].EqualFold(rdn)
+	newDN := remoteID
+	if renamed {
+		// 保留条目原来的上级
+		dn.RDNs[0] = rdn
+		newDN = dn.String()
+	}
+
+	req := ldap.NewModifyRequest(newDN, nil)
+	attrs := c.attributes(user)
+	for _, name := range slices.Sorted(maps.Keys(attrs)) {
+		if name == c.cfg.RDNAttribute {
+			continue
+		}
+		value := attrs[name]
+		if value == "" && slices.Contains(ldapNamingAttributes, name) {
+			value = user.UserName
+		}
+		if value == "" {
+			req.Replace(name, nil)
+		} else {
+			req.Replace(name, []string{value})
+		}
+	}
+	if c.cfg.DisableAttribute != "" {
+		req.Replace(c.cfg.DisableAttribute, nil)
+	}
+	result, err := c.do(ctx, "modify", func(conn ldapClient) error {
+		if renamed {
+			// 原条目不存在时可能已在之前的重试中改名，继续修改新条目
+			err := conn.ModifyDN(ldap.NewModifyDNRequest(remoteID, rdn.String(), true, ""))
+			if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+				return fmt.Errorf("rename to %s: %w", newDN, err)
+			}
+		}
+		return conn.Modify(req)
+	})
+	if err != nil {
+		return result, err
+	}
+	result.RemoteID = newDN
+	return result, nil
+}
+
+// Disable 写入停用属性；未配置停用属性时删除条目，重新启用时重新创建
+func (c *ldapConnector) Disable(ctx context.Context, remoteID string) (Result, error) {
+	if c.cfg.DisableAttribute == "" {
+		result, err := c.Delete(ctx, remoteID)
+		result.Deleted = true
+		return result, err
+	}
+	req := ldap.NewModifyRequest(remoteID, nil)
+	req.Replace(c.cfg.DisableAttribute, []string{c.cfg.DisableValue})
+	return c.do(ctx, "modify", func(conn ldapClient) error { return conn.Modify(req) })
+}
+
+// Delete 删除条目，条目已不存在时视为成功
+func (c *ldapConnector) Delete(ctx context.Context, remoteID string) (Result, error) {
+	req := ldap.NewDelRequest(remoteID, nil)
+	result, err := c.do(ctx, "delete", func(conn ldapClient) error { return conn.Del(req) })
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		return result, nil
+	}
+	return result, err
+}
+
+// Lookup 在 BaseDN 子树中按 RDN 属性查找条目
+func (c *ldapConnector) Lookup(ctx context.Context, userName string) (Result, error) {
+	filter := fmt.Sprintf("(%s=%s)", c.cfg.RDNAttribute, ldap.EscapeFilter(userName))
+	req := ldap.NewSearchRequest(c.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(c.cfg.Timeout/time.Second), false, filter, []string{"dn"}, nil)
+
+	var entries []*ldap.Entry
+	result, err := c.do(ctx, "search", func(conn ldapClient) error {
+		res, err := conn.Search(req)
+		if res != nil {
+			entries = res.Entries
+		}
+		return err
+	})
+	if err != nil {
+		return result, err
+	}
+	if len(entries) == 0 {
+		return result, ErrNotFound
+	}
+	if len(entries) > 1 {
+		return result, fmt.Errorf("LDAP search %s matched %d entries", filter, len(entries))
+	}
+	result.RemoteID = entries[0].DN
+	return result, nil
+}
+
+// do 连接并绑定目录服务器后执行操作，Result.Code 为 LDAP 结果码
+func (c *ldapConnector) do(ctx context.Context, op string, fn func(conn ldapClient) error) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	// 每次连接重新读取证书文件
+	tlsCfg, err := tlsutil.Load(c.tls)
+	if err != nil {
+		return Result{}, err
+	}
+	conn, err := dialLDAP(c.cfg, tlsCfg)
+	if err != nil {
+		return Result{}, unavailable(fmt.Errorf("failed to connect to %s: %w", c.cfg.URL, err))
+	}
+	defer conn.Close()
+	// 请求取消时关闭连接，中断阻塞的操作
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if c.cfg.BindDN != "" {
+		password, err := readSecret("bindPassword", c.cfg.BindPassword, c.cfg.BindPasswordFile)
+		if err != nil {
+			return Result{}, err
+		}
+		if err := conn.Bind(c.cfg.BindDN, password); err != nil {
+			result := ldapResult(err)
+			err = fmt.Errorf("LDAP bind as %s failed: %w", c.cfg.BindDN, err)
+			if ldapUnavailable(err) {
+				err = unavailable(err)
+			}
+			return result, err
+		}
+	}
+	if err := fn(conn); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return Result{}, ctxErr
+		}
+		result := ldapResult(err)
+		err = fmt.Errorf("LDAP %s failed: %w", op, err)
+		if ldapUnavailable(err) {
+			err = unavailable(err)
+		}
+		return result, err
+	}
+	return Result{Code: ldap.LDAPResultSuccess, Message: ldap.LDAPResultCodeMap[ldap.LDAPResultSuccess]}, nil
+}
+
+// userDN 用户条目的 DN
+func (c *ldapConnector) userDN(userName string) string {
+	return c.rdn(userName).String() + "," + c.cfg.BaseDN
+}
+
+// rdn 用户条目的 RDN
+func (c *ldapConnector) rdn(userName string) *ldap.RelativeDN {
+	return &ldap.RelativeDN{Attributes: []*ldap.AttributeTypeAndValue{{Type: c.cfg.RDNAttribute, Value: userName}}}
+}
+
+// attributes 按映射取得 LDAP 属性值
+func (c *ldapConnector) attributes(user User) map[string]string {
+	fields := user.Fields()
+	attrs := make(map[string]string, len(c.cfg.Attributes))
+	for attr, field := range c.cfg.Attributes {
+		attrs[attr] = fmt.Sprint(fields[field])
+	}
+	return attrs
+}
+
+// ldapUnavailable 连接断开或目录服务器忙、不可用
+func ldapUnavailable(err error) bool {
+	return ldap.IsErrorAnyOf(err, ldap.ErrorNetwork, ldap.LDAPResultBusy, ldap.LDAPResultUnavailable)
+}
+
+// ldapResult 将 LDAP 错误转换为调用结果
+func ldapResult(err error) Result {
+	var ldapErr *ldap.Error
+	if errors.As(err, &ldapErr) {
+		return Result{Code: int(ldapErr.ResultCode), Message: ldap.LDAPResultCodeMap[ldapErr.ResultCode]}
+	}
+	return Result{Message: err.Error()}
+}
@@ -0,0 +1,245 @@
+package connector
+
+import (
+	"center/pkg/config"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// directory 进程内的 LDAP 目录，按 DN（小写）保存条目属性
+type directory struct {
+	mu      sync.Mutex
+	entries map[string]map[string][]string
+	binds   []string
+}
+
+// dirConn 到 directory 的一个连接
+type dirConn struct{ dir *directory }
+
+// filterEquality 连接器查找使用的 (属性=值) 过滤器
+var filterEquality = regexp.MustCompile(`^\(([A-Za-z]+)=(.*)\)$`)
+
+func newDirectory(t *testing.T) *directory {
+	dir := &directory{entries: make(map[string]map[string][]string)}
+	orig := dialLDAP
+	dialLDAP = func(cfg config.LDAPConfig, tlsCfg *tls.Config) (ldapClient, error) {
+		return &dirConn{dir: dir}, nil
+	}
+	t.Cleanup(func() { dialLDAP = orig })
+	return dir
+}
+
+func (d *directory) entry(dn string) map[string][]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.entries[strings.ToLower(dn)]
+}
+
+func noSuchObject(dn string) error {
+	return ldap.NewError(ldap.LDAPResultNoSuchObject, fmt.Errorf("no such object %s", dn))
+}
+
+func (c *dirConn) Bind(username, password string) error {
+	if password != "secret" {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	c.dir.binds = append(c.dir.binds, username)
+	return nil
+}
+
+func (c *dirConn) Add(req *ldap.AddRequest) error {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	key := strings.ToLower(req.DN)
+	if _, ok := c.dir.entries[key]; ok {
+		return ldap.NewError(ldap.LDAPResultEntryAlreadyExists, fmt.Errorf("%s exists", req.DN))
+	}
+	attrs := make(map[string][]string)
+	for _, attr := range req.Attributes {
+		attrs[attr.Type] = attr.Vals
+	}
+	c.dir.entries[key] = attrs
+	return nil
+}
+
+func (c *dirConn) Modify(req *ldap.ModifyRequest) error {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	attrs, ok := c.dir.entries[strings.ToLower(req.DN)]
+	if !ok {
+		return noSuchObject(req.DN)
+	}
+	for _, change := range req.Changes {
+		if change.Operation != ldap.ReplaceAttribute {
+			return fmt.Errorf("unsupported modify operation %d", change.Operation)
+		}
+		if len(change.Modification.Vals) == 0 {
+			delete(attrs, change.Modification.Type)
+		} else {
+			attrs[change.Modification.Type] = change.Modification.Vals
+		}
+	}
+	return nil
+}
+
+func (c *dirConn) ModifyDN(req *ldap.ModifyDNRequest) error {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	key := strings.ToLower(req.DN)
+	attrs, ok := c.dir.entries[key]
+	if !ok {
+		return noSuchObject(req.DN)
+	}
+	_, parent, _ := strings.Cut(req.DN, ",")
+	delete(c.dir.entries, key)
+	c.dir.entries[strings.ToLower(req.NewRDN+","+parent)] = attrs
+	return nil
+}
+
+func (c *dirConn) Del(req *ldap.DelRequest) error {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	key := strings.ToLower(req.DN)
+	if _, ok := c.dir.entries[key]; !ok {
+		return noSuchObject(req.DN)
+	}
+	delete(c.dir.entries, key)
+	return nil
+}
+
+func (c *dirConn) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	c.dir.mu.Lock()
+	defer c.dir.mu.Unlock()
+	match := filterEquality.FindStringSubmatch(req.Filter)
+	if match == nil {
+		return nil, fmt.Errorf("unsupported filter %s", req.Filter)
+	}
+	result := &ldap.SearchResult{}
+	for dn, attrs := range c.dir.entries {
+		if strings.HasSuffix(dn, strings.ToLower(req.BaseDN)) && len(attrs[match[1]]) > 0 && attrs[match[1]][0] == match[2] {
+			result.Entries = append(result.Entries, &ldap.Entry{DN: dn})
+		}
+	}
+	return result, nil
+}
+
+func (c *dirConn) Close() error { return nil }
+
+func newTestLDAP(t *testing.T, cfg config.LDAPConfig) Connector {
+	t.Helper()
+	cfg.URL, cfg.BaseDN = "ldap://directory.test", "ou=people,dc=example,dc=com"
+	cfg.BindDN, cfg.BindPassword = "cn=admin,dc=example,dc=com", "secret"
+	conn, err := factories["ldap"](App{AppID: 1, Config: config.AppConfig{LDAP: cfg}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestLDAPLifecycle(t *testing.T) {
+	ctx := context.Background()
+	dir := newDirectory(t)
+	conn := newTestLDAP(t, config.LDAPConfig{DisableAttribute: "nsAccountLock", DisableValue: "true"})
+
+	created, err := conn.Create(ctx, User{UserName: "alice", Name: "Alice", Email: "alice@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const dn = "uid=alice,ou=people,dc=example,dc=com"
+	if created.RemoteID != dn {
+		t.Fatalf("created DN = %s, want %s", created.RemoteID, dn)
+	}
+	entry := dir.entry(dn)
+	if entry["mail"][0] != "alice@example.com" || entry["cn"][0] != "Alice" || len(entry["objectClass"]) != 4 {
+		t.Errorf("created entry = %v", entry)
+	}
+	if len(dir.binds) == 0 || dir.binds[0] != "cn=admin,dc=example,dc=com" {
+		t.Errorf("binds = %v", dir.binds)
+	}
+
+	found, err := conn.Lookup(ctx, "alice")
+	if err != nil || found.RemoteID != dn {
+		t.Errorf("Lookup() = %q, %v", found.RemoteID, err)
+	}
+	if _, err := conn.Lookup(ctx, "bob"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup() of a missing user = %v, want ErrNotFound", err)
+	}
+
+	// 停用后更新恢复条目
+	if _, err := conn.Disable(ctx, dn); err != nil {
+		t.Fatal(err)
+	}
+	if got := dir.entry(dn)["nsAccountLock"]; len(got) != 1 || got[0] != "true" {
+		t.Fatalf("disabled entry lock = %v", got)
+	}
+	if _, err := conn.Update(ctx, dn, User{UserName: "alice", Name: "Alice", Email: "alice@example.org"}); err != nil {
+		t.Fatal(err)
+	}
+	entry = dir.entry(dn)
+	if _, locked := entry["nsAccountLock"]; locked || entry["mail"][0] != "alice@example.org" {
+		t.Errorf("updated entry = %v, want unlocked with the new mail", entry)
+	}
+
+	// 再次创建已停用的条目同样恢复
+	if _, err := conn.Disable(ctx, dn); err != nil {
+		t.Fatal(err)
+	}
+	recreated, err := conn.Create(ctx, User{UserName: "alice", Name: "Alice"})
+	if err != nil || recreated.RemoteID != dn {
+		t.Fatalf("Create() of an existing entry = %q, %v", recreated.RemoteID, err)
+	}
+	if _, locked := dir.entry(dn)["nsAccountLock"]; locked {
+		t.Errorf("existing entry stays locked after create")
+	}
+
+	// 改名时条目改为新的 RDN
+	renamed, err := conn.Update(ctx, dn, User{UserName: "alice2", Name: "Alice"})
+	const newDN = "uid=alice2,ou=people,dc=example,dc=com"
+	if err != nil || renamed.RemoteID != newDN || dir.entry(newDN) == nil || dir.entry(dn) != nil {
+		t.Fatalf("rename = %q, %v", renamed.RemoteID, err)
+	}
+
+	if _, err := conn.Delete(ctx, newDN); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Delete(ctx, newDN); err != nil {
+		t.Errorf("Delete() of a missing entry = %v, want success", err)
+	}
+}
+
+func TestLDAPDisableWithoutAttributeDeletes(t *testing.T) {
+	ctx := context.Background()
+	dir := newDirectory(t)
+	conn := newTestLDAP(t, config.LDAPConfig{})
+	created, err := conn.Create(ctx, User{UserName: "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := dir.entry(created.RemoteID); entry["cn"][0] != "bob" || entry["sn"][0] != "bob" {
+		t.Errorf("naming attributes of %v not filled from the userName", entry)
+	}
+	result, err := conn.Disable(ctx, created.RemoteID)
+	if err != nil || !result.Deleted || dir.entry(created.RemoteID) != nil {
+		t.Errorf("Disable() = %+v, %v, want the entry deleted", result, err)
+	}
+}
+
+func TestLDAPBindFailure(t *testing.T) {
+	newDirectory(t)
+	conn := newTestLDAP(t, config.LDAPConfig{})
+	conn.(*ldapConnector).cfg.BindPassword = "wrong"
+	result, err := conn.Create(context.Background(), User{UserName: "carol"})
+	if err == nil || result.Code != ldap.LDAPResultInvalidCredentials || errors.Is(err, ErrUnavailable) {
+		t.Errorf("Create() with a wrong password = %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,212 @@
+package connector
+
+import (
+	"bytes"
+	"center/pkg/config"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 响应 ID 来源
+const (
+	idFromBody   = "body"
+	idFromHeader = "header"
+	idFromText   = "text"
+
+	codePathNone = "-" // 不检查返回码
+)
+
+// defaultResponse 应用自定义接口的默认判定：2xx 且 code 为 1，ID 在 data[0].userId
+var defaultResponse = config.ResponseConfig{
+	SuccessStatus: []string{"200-299"},
+	CodePath:      "code",
+	SuccessCodes:  []string{"1"},
+	MessagePath:   "message",
+	IDFrom:        idFromBody,
+	IDPath:        "data.0.userId",
+}
+
+// statusRange 闭区间的 HTTP 状态码范围
+type statusRange struct{ low, high int }
+
+// responseCriteria 编译后的响应判定
+type responseCriteria struct {
+	cfg           config.ResponseConfig
+	successStatus []statusRange
+	existsStatus  []statusRange
+}
+
+// responseOutcome 一次响应的判定结果
+type responseOutcome struct {
+	Result
+	exists bool // 下游返回账号已存在
+}
+
+// newResponseCriteria fills in the defaults for the fields the app leaves unset
+// and parses the status ranges.
+func newResponseCriteria(cfg config.ResponseConfig) (*responseCriteria, error) {
+	if len(cfg.SuccessStatus) == 0 {
+		cfg.SuccessStatus = defaultResponse.SuccessStatus
+	}
+	switch {
+	case cfg.CodePath == codePathNone:
+		// 仅按 HTTP 状态码判定
+		cfg.CodePath, cfg.SuccessCodes, cfg.ExistsCodes = "", nil, nil
+	case cfg.CodePath == "" && len(cfg.SuccessCodes) == 0:
+		cfg.CodePath, cfg.SuccessCodes = defaultResponse.CodePath, defaultResponse.SuccessCodes
+	case cfg.CodePath == "":
+		cfg.CodePath = defaultResponse.CodePath
+	case len(cfg.SuccessCodes) == 0:
+		return nil, fmt.Errorf("codePath %s requires successCodes", cfg.CodePath)
+	}
+	if cfg.MessagePath == "" {
+		cfg.MessagePath = defaultResponse.MessagePath
+	}
+	if cfg.IDFrom == "" {
+		cfg.IDFrom = defaultResponse.IDFrom
+	}
+	switch cfg.IDFrom {
+	case idFromBody:
+		if cfg.IDPath == "" {
+			cfg.IDPath = defaultResponse.IDPath
+		}
+	case idFromHeader:
+		if cfg.IDHeader == "" {
+			return nil, fmt.Errorf("idFrom header requires idHeader")
+		}
+	case idFromText:
+	default:
+		return nil, fmt.Errorf("idFrom %q must be one of body, header, text", cfg.IDFrom)
+	}
+
+	successStatus, err := parseStatusRanges(cfg.SuccessStatus)
+	if err != nil {
+		return nil, fmt.Errorf("successStatus: %w", err)
+	}
+	existsStatus, err := parseStatusRanges(cfg.ExistsStatus)
+	if err != nil {
+		return nil, fmt.Errorf("existsStatus: %w", err)
+	}
+	return &responseCriteria{cfg: cfg, successStatus: successStatus, existsStatus: existsStatus}, nil
+}
+
+// evaluate judges a downstream response. A body that is not JSON, or has no
+// code at CodePath, is judged by the HTTP status alone.
+func (rc *responseCriteria) evaluate(resp *http.Response, body []byte) (responseOutcome, error) {
+	out := responseOutcome{Result: Result{Code: resp.StatusCode, Message: resp.Status}}
+
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if decoder.Decode(&doc) != nil {
+		doc = nil
+	}
+	if msg, ok := jsonPath(doc, rc.cfg.MessagePath); ok && msg != nil {
+		out.Message = fmt.Sprint(msg)
+	}
+	code, hasCode := jsonPath(doc, rc.cfg.CodePath)
+	if hasCode {
+		if n, err := strconv.Atoi(fmt.Sprint(code)); err == nil {
+			out.Code = n
+		}
+	}
+
+	if inRanges(rc.existsStatus, resp.StatusCode) || (hasCode && slices.Contains(rc.cfg.ExistsCodes, fmt.Sprint(code))) {
+		out.exists = true
+		return out, nil
+	}
+	if !inRanges(rc.successStatus, resp.StatusCode) {
+		err := fmt.Errorf("请求失败: %s (状态码: %d)", out.Message, resp.StatusCode)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			err = unavailable(err)
+		}
+		return out, err
+	}
+	if hasCode && !slices.Contains(rc.cfg.SuccessCodes, fmt.Sprint(code)) {
+		return out, fmt.Errorf("请求失败: %s (错误码: %v)", out.Message, code)
+	}
+
+	switch rc.cfg.IDFrom {
+	case idFromBody:
+		if id, ok := jsonPath(doc, rc.cfg.IDPath); ok && id != nil {
+			out.RemoteID = fmt.Sprint(id)
+		}
+	case idFromHeader:
+		// Location 等 URL 取最后一段作为 ID
+		if value := resp.Header.Get(rc.cfg.IDHeader); value != "" {
+			out.RemoteID = path.Base(strings.TrimRight(value, "/"))
+		}
+	case idFromText:
+		out.RemoteID = strings.TrimSpace(string(body))
+	}
+	return out, nil
+}
+
+// jsonPath 按点分路径读取 JSON 值，数组下标为数字，如 data.0.userId
+func jsonPath(doc any, p string) (any, bool) {
+	if p == "" || doc == nil {
+		return nil, false
+	}
+	cur := doc
+	for _, key := range strings.Split(p, ".") {
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// parseStatusRanges 解析 200-299、201、2xx 形式的状态码范围
+func parseStatusRanges(list []string) ([]statusRange, error) {
+	ranges := make([]statusRange, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		var r statusRange
+		var err error
+		if len(s) == 3 && strings.HasSuffix(strings.ToLower(s), "xx") {
+			var class int
+			class, err = strconv.Atoi(s[:1])
+			r = statusRange{class * 100, class*100 + 99}
+		} else if low, high, ok := strings.Cut(s, "-"); ok {
+			r.low, err = strconv.Atoi(strings.TrimSpace(low))
+			if err == nil {
+				r.high, err = strconv.Atoi(strings.TrimSpace(high))
+			}
+		} else {
+			r.low, err = strconv.Atoi(s)
+			r.high = r.low
+		}
+		if err != nil || r.low < 100 || r.high > 599 || r.low > r.high {
+			return nil, fmt.Errorf("invalid status range %q", s)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func inRanges(ranges []statusRange, status int) bool {
+	for _, r := range ranges {
+		if status >= r.low && status <= r.high {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package connector
+
+import (
+	"center/pkg/config"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestParseStatusRanges(t *testing.T) {
+	ranges, err := parseStatusRanges([]string{"2xx", " 409 ", "400-404"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for status, want := range map[int]bool{200: true, 299: true, 300: false, 409: true, 400: true, 404: true, 405: false} {
+		if inRanges(ranges, status) != want {
+			t.Errorf("inRanges(%d) = %v, want %v", status, !want, want)
+		}
+	}
+	for _, s := range []string{"abc", "99", "600", "300-200", "9xx"} {
+		if _, err := parseStatusRanges([]string{s}); err == nil {
+			t.Errorf("parseStatusRanges(%q) succeeded", s)
+		}
+	}
+}
+
+func TestNewResponseCriteriaErrors(t *testing.T) {
+	for name, cfg := range map[string]config.ResponseConfig{
+		"code path without codes": {CodePath: "status"},
+		"header without name":     {IDFrom: idFromHeader},
+		"unknown id source":       {IDFrom: "cookie"},
+		"bad status":              {SuccessStatus: []string{"2yy"}},
+	} {
+		if _, err := newResponseCriteria(cfg); err == nil {
+			t.Errorf("%s: newResponseCriteria() succeeded", name)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cfg     config.ResponseConfig
+		status  int
+		header  http.Header
+		body    string
+		want    responseOutcome
+		wantErr bool
+		unavail bool
+	}{
+		{
+			name: "default success", status: 200,
+			body: `{"code":1,"message":"ok","data":[{"userId":42}]}`,
+			want: responseOutcome{Result: Result{RemoteID: "42", Code: 1, Message: "ok"}},
+		},
+		{
+			name: "default error code", status: 200,
+			body:    `{"code":0,"message":"duplicate"}`,
+			want:    responseOutcome{Result: Result{Code: 0, Message: "duplicate"}},
+			wantErr: true,
+		},
+		{
+			name: "server error", status: 503, body: `not json`,
+			want:    responseOutcome{Result: Result{Code: 503, Message: "503 Service Unavailable"}},
+			wantErr: true, unavail: true,
+		},
+		{
+			name: "client error", status: 400, body: `{"message":"bad"}`,
+			want:    responseOutcome{Result: Result{Code: 400, Message: "bad"}},
+			wantErr: true,
+		},
+		{
+			name: "exists status", cfg: config.ResponseConfig{ExistsStatus: []string{"409"}}, status: 409,
+			want: responseOutcome{Result: Result{Code: 409, Message: "409 Conflict"}, exists: true},
+		},
+		{
+			name: "exists code", cfg: config.ResponseConfig{CodePath: "errcode", SuccessCodes: []string{"0"}, ExistsCodes: []string{"40001"}},
+			status: 200, body: `{"errcode":40001}`,
+			want: responseOutcome{Result: Result{Code: 40001, Message: "200 OK"}, exists: true},
+		},
+		{
+			name: "status only with header id", cfg: config.ResponseConfig{CodePath: codePathNone, IDFrom: idFromHeader, IDHeader: "Location"},
+			status: 201, header: http.Header{"Location": {"https://app/users/abc/"}}, body: `{"code":0}`,
+			want: responseOutcome{Result: Result{RemoteID: "abc", Code: 201, Message: "201 Created"}},
+		},
+		{
+			name: "text id", cfg: config.ResponseConfig{CodePath: codePathNone, IDFrom: idFromText},
+			status: 200, body: " u-7\n",
+			want: responseOutcome{Result: Result{RemoteID: "u-7", Code: 200, Message: "200 OK"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rc, err := newResponseCriteria(tc.cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := &http.Response{StatusCode: tc.status, Status: fmt.Sprintf("%d %s", tc.status, http.StatusText(tc.status)), Header: tc.header}
+			if resp.Header == nil {
+				resp.Header = http.Header{}
+			}
+			got, err := rc.evaluate(resp, []byte(tc.body))
+			if (err != nil) != tc.wantErr || errors.Is(err, ErrUnavailable) != tc.unavail {
+				t.Errorf("evaluate() error = %v, want error %v, unavailable %v", err, tc.wantErr, tc.unavail)
+			}
+			if got != tc.want {
+				t.Errorf("evaluate() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SCIM 2.0 schema 和媒体类型 (RFC 7643/7644)
+const (
+	scimUserSchema    = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimPatchOpSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	contentTypeSCIM   = "application/scim+json"
+)
+
+func init() {
+	Register("scim", func(app App) (Connector, error) {
+		base := app.Config.SCIM.BaseURL
+		if base == "" {
+			base = app.Address
+		}
+		if base == "" {
+			return nil, fmt.Errorf("app %d has no SCIM base URL", app.AppID)
+		}
+		return &scimConnector{baseURL: strings.TrimSuffix(base, "/"), client: app.Client}, nil
+	})
+}
+
+// scimConnector 通过 SCIM 2.0 /Users 接口开通下游账号，RemoteID 为 SCIM 资源 id
+type scimConnector struct {
+	baseURL string
+	client  *http.Client
+}
+
+type scimName struct {
+	Formatted string `json:"formatted,omitempty"`
+}
+
+type scimMultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// scimUser SCIM 核心用户属性
+type scimUser struct {
+	Schemas      []string         `json:"schemas,omitempty"`
+	ID           string           `json:"id,omitempty"`
+	UserName     string           `json:"userName"`
+	Name         *scimName        `json:"name,omitempty"`
+	DisplayName  string           `json:"displayName,omitempty"`
+	Emails       []scimMultiValue `json:"emails,omitempty"`
+	PhoneNumbers []scimMultiValue `json:"phoneNumbers,omitempty"`
+	Active       *bool            `json:"active,omitempty"`
+}
+
+type scimPatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path,omitempty"`
+	Value any    `json:"value"`
+}
+
+type scimPatch struct {
+	Schemas    []string      `json:"schemas"`
+	Operations []scimPatchOp `json:"Operations"`
+}
+
+type scimListResponse struct {
+	TotalResults int        `json:"totalResults"`
+	Resources    []scimUser `json:"Resources"`
+}
+
+type scimError struct {
+	Detail   string `json:"detail"`
+	ScimType string `json:"scimType"`
+}
+
+// toSCIMUser 将用户资料映射为 SCIM 核心属性
+func toSCIMUser(user User) scimUser {
+	active := true
+	su := scimUser{
+		Schemas:     []string{scimUserSchema},
+		UserName:    user.UserName,
+		DisplayName: user.Name,
+		Active:      &active,
+	}
+	if user.Name != "" {
+		su.Name = &scimName{Formatted: user.Name}
+	}
+	if user.Email != "" {
+		su.Emails = []scimMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	if user.Mobile != "" {
+		su.PhoneNumbers = []scimMultiValue{{Value: user.Mobile, Type: "mobile", Primary: true}}
+	}
+	return su
+}
+
+// Create 创建用户，409 (uniqueness) 时查找已有的资源 id
+func (c *scimConnector) Create(ctx context.Context, user User) (Result, error) {
+	var created scimUser
+	result, err := c.do(ctx, http.MethodPost, c.baseURL+"/Users", toSCIMUser(user), &created)
+	if err != nil && result.Code == http.StatusConflict {
+		existing, lookupErr := c.Lookup(ctx, user.UserName)
+		if lookupErr != nil {
+			return result, fmt.Errorf("%w; lookup of existing user failed: %w", err, lookupErr)
+		}
+		result.RemoteID, result.Message = existing.RemoteID, "already exists"
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	if created.ID == "" {
+		return result, fmt.Errorf("SCIM create returned no id")
+	}
+	result.RemoteID = created.ID
+	return result, nil
+}
+
+// Update 以 PATCH replace 更新用户资料，同时设置 active=true 恢复已停用的用户
+func (c *scimConnector) Update(ctx context.Context, remoteID string, user User) (Result, error) {
+	su := toSCIMUser(user)
+	value := map[string]any{
+		"userName":    su.UserName,
+		"displayName": su.DisplayName,
+		"active":      true,
+	}
+	if su.Name != nil {
+		value["name"] = su.Name
+	}
+	if su.Emails != nil {
+		value["emails"] = su.Emails
+	}
+	if su.PhoneNumbers != nil {
+		value["phoneNumbers"] = su.PhoneNumbers
+	}
+	return c.patch(ctx, remoteID, scimPatchOp{Op: "replace", Value: value})
+}
+
+// Disable 以 PATCH active=false 停用用户
+func (c *scimConnector) Disable(ctx context.Context, remoteID string) (Result, error) {
+	return c.patch(ctx, remoteID, scimPatchOp{Op: "replace", Path: "active", Value: false})
+}
+
+// Delete 删除用户，资源已不存在时视为成功
+func (c *scimConnector) Delete(ctx context.Context, remoteID string) (Result, error) {
+	result, err := c.do(ctx, http.MethodDelete, c.userURL(remoteID), nil, nil)
+	if err != nil && result.Code == http.StatusNotFound {
+		return result, nil
+	}
+	return result, err
+}
+
+// Lookup 以 filter=userName eq "..." 查找用户
+func (c *scimConnector) Lookup(ctx context.Context, userName string) (Result, error) {
+	filter := fmt.Sprintf(`userName eq "%s"`, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(userName))
+	target := c.baseURL + "/Users?" + url.Values{"filter": {filter}}.Encode()
+
+	var list scimListResponse
+	result, err := c.do(ctx, http.MethodGet, target, nil, &list)
+	if err != nil {
+		return result, err
+	}
+	for _, su := range list.Resources {
+		if strings.EqualFold(su.UserName, userName) {
+			result.RemoteID = su.ID
+			return result, nil
+		}
+	}
+	return result, ErrNotFound
+}
+
+func (c *scimConnector) patch(ctx context.Context, remoteID string, ops ...scimPatchOp) (Result, error) {
+	body := scimPatch{Schemas: []string{scimPatchOpSchema}, Operations: ops}
+	return c.do(ctx, http.MethodPatch, c.userURL(remoteID), body, nil)
+}
+
+func (c *scimConnector) userURL(remoteID string) string {
+	return c.baseURL + "/Users/" + url.PathEscape(remoteID)
+}
+
+// do 发送 SCIM 请求，Result.Code 为 HTTP 状态码，非 2xx 时返回 SCIM 错误详情
+func (c *scimConnector) do(ctx context.Context, method, target string, payload, out any) (Result, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return Result{}, fmt.Errorf("failed to marshal SCIM request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", contentTypeSCIM)
+	}
+	req.Header.Set("Accept", contentTypeSCIM)
+	setIdempotencyKey(req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return Result{}, unavailable(fmt.Errorf("failed to send request: %w", err))
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Result{}, unavailable(fmt.Errorf("failed to read response body: %w", err))
+	}
+
+	result := Result{Code: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var scimErr scimError
+		if json.Unmarshal(body, &scimErr) == nil && scimErr.Detail != "" {
+			result.Message = scimErr.Detail
+		}
+		err := fmt.Errorf("SCIM %s %s returned status %d: %s", method, target, resp.StatusCode, result.Message)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			err = unavailable(err)
+		}
+		return result, err
+	}
+	if out != nil && len(body) > 0 {
+		if err := json.Unmarshal(body, out); err != nil {
+			return result, fmt.Errorf("failed to parse SCIM response: %w", err)
+		}
+	}
+	return result, nil
+}
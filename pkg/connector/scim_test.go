@@ -0,0 +1,64 @@
+package connector
+
+import (
+	"center/pkg/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// activeOf PATCH 请求中设置的 active 值
+func activeOf(t *testing.T, r *http.Request) any {
+	t.Helper()
+	var patch struct {
+		Operations []struct {
+			Path  string `json:"path"`
+			Value any    `json:"value"`
+		} `json:"Operations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range patch.Operations {
+		if op.Path == "active" {
+			return op.Value
+		}
+		if value, ok := op.Value.(map[string]any); ok && op.Path == "" {
+			if active, ok := value["active"]; ok {
+				return active
+			}
+		}
+	}
+	return nil
+}
+
+func TestSCIMActive(t *testing.T) {
+	var got []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPatch || r.URL.Path != "/scim/v2/Users/abc" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+		got = append(got, activeOf(t, r))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	conn, err := factories["scim"](App{AppID: 1, Config: config.AppConfig{SCIM: config.SCIMConfig{BaseURL: server.URL + "/scim/v2"}}, Client: server.Client()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := conn.Disable(ctx, "abc"); err != nil {
+		t.Fatal(err)
+	}
+	// 更新同时恢复停用的账号
+	if _, err := conn.Update(ctx, "abc", User{UserName: "alice", Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != false || got[1] != true {
+		t.Errorf("active values = %v, want [false true]", got)
+	}
+}
@@ -0,0 +1,54 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 可单独配置超时的下游操作，与 config.Operations 一致
+const (
+	opCreate  = "create"
+	opUpdate  = "update"
+	opDisable = "disable"
+	opDelete  = "delete"
+	opLookup  = "lookup"
+)
+
+// timedConnector 为每次下游调用设置超时，超时计为下游不可达
+type timedConnector struct {
+	conn  Connector
+	appID uint64
+}
+
+func (t timedConnector) call(ctx context.Context, op string, fn func(ctx context.Context) (Result, error)) (Result, error) {
+	timeout := Timeout(t.appID, op)
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := fn(callCtx)
+	// 调用方取消时保留原错误，只有本次调用超时才标记为不可达
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) && !errors.Is(err, ErrUnavailable) {
+		err = unavailable(fmt.Errorf("%s timed out after %s: %w", op, timeout, err))
+	}
+	return result, err
+}
+
+func (t timedConnector) Create(ctx context.Context, user User) (Result, error) {
+	return t.call(ctx, opCreate, func(ctx context.Context) (Result, error) { return t.conn.Create(ctx, user) })
+}
+
+func (t timedConnector) Update(ctx context.Context, remoteID string, user User) (Result, error) {
+	return t.call(ctx, opUpdate, func(ctx context.Context) (Result, error) { return t.conn.Update(ctx, remoteID, user) })
+}
+
+func (t timedConnector) Disable(ctx context.Context, remoteID string) (Result, error) {
+	return t.call(ctx, opDisable, func(ctx context.Context) (Result, error) { return t.conn.Disable(ctx, remoteID) })
+}
+
+func (t timedConnector) Delete(ctx context.Context, remoteID string) (Result, error) {
+	return t.call(ctx, opDelete, func(ctx context.Context) (Result, error) { return t.conn.Delete(ctx, remoteID) })
+}
+
+func (t timedConnector) Lookup(ctx context.Context, userName string) (Result, error) {
+	return t.call(ctx, opLookup, func(ctx context.Context) (Result, error) { return t.conn.Lookup(ctx, userName) })
+}
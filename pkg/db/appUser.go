@@ -0,0 +1,115 @@
+package db
+
+import (
+	"center/model"
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// inBatch 按 IN 列表查询时每批的参数个数，避免超出数据库的占位符上限
+const inBatch = 1000
+
+// AppUserQuery 查询已授权某应用的用户
+type AppUserQuery struct {
+	AppID    uint64
+	UserName string // 非空时按账号过滤
+	UserID   uint64 // 非空时按用户ID过滤
+	Offset   int
+	Limit    int // 0 表示只统计总数
+}
+
+// 已授权应用的用户：jos_user_app 中的授权，或 proxy_user_app 中开通了但没有授权的用户 extra
+func (d *Database) appUsers(ctx context.Context, q AppUserQuery, extra []uint64) *gorm.DB {
+	granted := d.JosDb.WithContext(ctx).Model(&model.JosUserApp{}).Select("user_id").Where("app_id = ?", q.AppID)
+	query := d.JosDb.WithContext(ctx).Model(&model.XjrUser{}).Where("delete_mark = 0")
+	cond := d.JosDb.WithContext(ctx).Where("id IN (?)", granted)
+	if len(extra) > 0 {
+		cond = cond.Or("id IN ?", extra)
+	}
+	query = query.Where(cond)
+	if q.UserName != "" {
+		query = query.Where("user_name = ?", q.UserName)
+	}
+	if q.UserID != 0 {
+		query = query.Where("id = ?", q.UserID)
+	}
+	return query
+}
+
+// ungrantedAppUsers proxy_user_app 中开通了应用、但 jos_user_app 中没有授权的用户ID。
+// 映射和授权在不同的库中无法联表，按批比对；映射通常都有授权，结果只有授权收回后尚未同步的少数用户
+func (d *Database) ungrantedAppUsers(ctx context.Context, appID uint64) ([]uint64, error) {
+	var extra []uint64
+	var batch []model.ProxyUserApp
+	err := d.StateDb.WithContext(ctx).Select("id", "user_id", "user_name").
+		Where("app_id = ? AND delete_mark = 0", appID).
+		FindInBatches(&batch, inBatch, func(tx *gorm.DB, _ int) error {
+			var ids []uint64
+			var userNames []string
+			for _, m := range batch {
+				if m.UserID != 0 {
+					ids = append(ids, m.UserID)
+				} else {
+					userNames = append(userNames, m.UserName)
+				}
+			}
+			// 未记录用户ID的旧映射按账号找到用户
+			if len(userNames) > 0 {
+				var named []uint64
+				if err := d.JosDb.WithContext(ctx).Model(&model.XjrUser{}).
+					Where("delete_mark = 0 AND user_name IN ?", userNames).Pluck("id", &named).Error; err != nil {
+					return err
+				}
+				ids = append(ids, named...)
+			}
+			var granted []uint64
+			if err := d.JosDb.WithContext(ctx).Model(&model.JosUserApp{}).
+				Where("app_id = ? AND user_id IN ?", appID, ids).Pluck("user_id", &granted).Error; err != nil {
+				return err
+			}
+			isGranted := make(map[uint64]bool, len(granted))
+			for _, id := range granted {
+				isGranted[id] = true
+			}
+			for _, id := range ids {
+				if !isGranted[id] {
+					extra = append(extra, id)
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to match mappings of app %d with grants: %w", appID, err)
+	}
+	return extra, nil
+}
+
+// 分页查询已授权应用的用户及总数
+func (d *Database) ListAppUsers(ctx context.Context, q AppUserQuery) ([]model.XjrUser, int64, error) {
+	extra, err := d.ungrantedAppUsers(ctx, q.AppID)
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if err := d.appUsers(ctx, q, extra).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count users of app %d: %w", q.AppID, err)
+	}
+	var users []model.XjrUser
+	if q.Limit > 0 && int64(q.Offset) < total {
+		if err := d.appUsers(ctx, q, extra).Order("id").Offset(q.Offset).Limit(q.Limit).Find(&users).Error; err != nil {
+			return nil, 0, fmt.Errorf("failed to list users of app %d: %w", q.AppID, err)
+		}
+	}
+	return users, total, nil
+}
+
+// 根据 app_id 获取应用，不存在时返回的错误包含 gorm.ErrRecordNotFound
+func (d *Database) GetJosAppByAppID(ctx context.Context, appID uint64) (model.JosApp, error) {
+	var app model.JosApp
+	if err := d.JosDb.WithContext(ctx).Where("app_id = ?", appID).First(&app).Error; err != nil {
+		return model.JosApp{}, fmt.Errorf("failed to query app with app_id %d: %w", appID, err)
+	}
+	return app, nil
+}
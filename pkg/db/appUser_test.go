@@ -0,0 +1,63 @@
+package db
+
+import (
+	"center/model"
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestListAppUsers(t *testing.T) {
+	ctx := context.Background()
+	d := openTestState(t)
+
+	// 多于一批的用户：偶数ID已授权，奇数ID只有映射；7 的倍数是未记录用户ID的旧映射；最后一个已删除
+	const n = 2*inBatch + 500
+	users := make([]model.XjrUser, 0, n)
+	var grants []model.JosUserApp
+	var mappings []model.ProxyUserApp
+	for i := 1; i <= n; i++ {
+		user := model.XjrUser{ID: int64(i), UserName: "user" + strconv.Itoa(i)}
+		users = append(users, user)
+		if i%2 == 0 {
+			grants = append(grants, model.JosUserApp{UserID: uint64(i), AppID: 10})
+		}
+		mapping := model.ProxyUserApp{UserID: uint64(i), UserName: user.UserName, AppID: 10}
+		if i%7 == 0 {
+			mapping.UserID = 0
+		}
+		mappings = append(mappings, mapping)
+	}
+	d.JosDb = openTestJos(t, users...)
+	if err := d.JosDb.AutoMigrate(&model.JosUserApp{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.JosDb.Exec("UPDATE xjr_user SET delete_mark = 1 WHERE id = ?", n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.JosDb.CreateInBatches(grants, 500).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.StateDb.CreateInBatches(mappings, 500).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	extra, err := d.ungrantedAppUsers(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := n / 2; len(extra) != want {
+		t.Errorf("ungranted users = %d, want %d", len(extra), want)
+	}
+
+	page, total, err := d.ListAppUsers(ctx, AppUserQuery{AppID: 10, Offset: n - 3, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != n-1 || len(page) != 2 || page[1].ID != n-1 {
+		t.Errorf("last page = %d users of %d, want 2 of %d ending with %d", len(page), total, n-1, n-1)
+	}
+	if _, total, err := d.ListAppUsers(ctx, AppUserQuery{AppID: 11}); err != nil || total != 0 {
+		t.Errorf("users of an app without grants = %d, %v", total, err)
+	}
+}
@@ -2,54 +2,75 @@ package db
 
 import (
 	"center/model"
+	"center/pkg/config"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"time"
+	"strconv"
+	"strings"
 
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-// 数据库配置常量
-const (
-	DBHost     = "join-mysql-standalone-svc:3306"
-	DBUser     = "root"
-	DBPassword = "zn123$%^zn"
-	DBName     = "user_center_workspace"
-)
-
-// 数据库服务封装
+// 数据库服务封装：JosDb 为用户中心库，StateDb 为代理自身的状态库
 type Database struct {
-	JosDb    *gorm.DB
-	SqliteDb *gorm.DB
+	JosDb   *gorm.DB
+	StateDb *gorm.DB
 }
 
 var DB Database
 
-func InitDB(path string) error {
-	err := initJosDB()
+func InitDB(cfg *config.Config) error {
+	err := initJosDB(cfg.Jos)
 	if err != nil {
 		return fmt.Errorf("failed to initialize MySQL database: %w", err)
 	}
 
-	return initSqliteDB(path)
+	return initStateDB(cfg.State)
+}
+
+// 将配置中的日志级别转换为 GORM 日志级别
+func parseLogLevel(level string) logger.LogLevel {
+	switch strings.ToLower(level) {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "warn":
+		return logger.Warn
+	default:
+		return logger.Info
+	}
 }
 
-func initJosDB() error {
+func initJosDB(cfg config.JosConfig) error {
+	db, err := OpenJos(cfg)
+	if err != nil {
+		return err
+	}
+	log.Println("Successfully connected to MySQL database")
+	DB.JosDb = db
+	return nil
+}
+
+// OpenJos opens and pings the user-center database.
+func OpenJos(cfg config.JosConfig) (*gorm.DB, error) {
 	// 构建DSN (Data Source Name)
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		DBUser, DBPassword, DBHost, DBName)
+	dsn := cfg.MySQLDSN()
 
 	// 配置GORM日志
 	newLogger := logger.New(
 		log.New(log.Writer(), "jos-database\r\n", log.LstdFlags),
 		logger.Config{
-			SlowThreshold: time.Second,
-			LogLevel:      logger.Info,
+			SlowThreshold: cfg.SlowThreshold,
+			LogLevel:      parseLogLevel(cfg.LogLevel),
 			Colorful:      true,
 		},
 	)
@@ -59,135 +80,272 @@ func initJosDB() error {
 		Logger: newLogger,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to connect database: %w", err)
+		return nil, fmt.Errorf("failed to connect database: %w", err)
 	}
 	// 测试连接
 	sqlDB, err := db.DB()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if err := sqlDB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %v", err)
+		return nil, fmt.Errorf("failed to ping database: %v", err)
 	}
 
 	// 设置连接池参数
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
 
-	log.Println("Successfully connected to MySQL database")
-	DB.JosDb = db
+// 初始化状态库连接，并执行或检查表结构迁移
+func initStateDB(cfg config.StateConfig) error {
+	db, err := OpenState(cfg)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	m, err := NewStateMigrator(db, DB.JosDb)
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if cfg.AutoMigrate {
+		if _, err := MigrateState(ctx, db, m, 0); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	} else {
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check database migrations: %w", err)
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("state database has %d pending migrations, run \"migrate up\" first", len(pending))
+		}
+	}
+
+	DB.StateDb = db
 	return nil
 }
 
-// 初始化数据库连接
-func initSqliteDB(dbPath string) error {
-	// 确保目录存在
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
-		log.Fatalf("创建目录失败: %v", err)
+// OpenState opens the proxy state database of the configured driver without
+// migrating it.
+func OpenState(cfg config.StateConfig) (*gorm.DB, error) {
+	dialector, err := stateDialector(cfg)
+	if err != nil {
+		return nil, err
 	}
 	// 配置GORM日志
 	newLogger := logger.New(
-		log.New(log.Writer(), "sqlite-database\r\n", log.LstdFlags),
+		log.New(log.Writer(), cfg.Driver+"-database\r\n", log.LstdFlags),
 		logger.Config{
-			SlowThreshold: time.Second,
-			LogLevel:      logger.Info,
+			SlowThreshold: cfg.SlowThreshold,
+			LogLevel:      parseLogLevel(cfg.LogLevel),
 			Colorful:      true,
 		},
 	)
 	// 打开数据库连接
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: newLogger,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to connect database: %w", err)
+		return nil, fmt.Errorf("failed to connect %s state database: %w", cfg.Driver, err)
+	}
+	if cfg.Driver == config.StateDriverSQLite {
+		return db, nil
 	}
 
-	// 自动迁移表结构
-	if err := db.AutoMigrate(&model.ProxyUserApp{}); err != nil {
-		return fmt.Errorf("failed to migrate database: %w", err)
+	// 设置连接池参数
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
 	}
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return db, nil
+}
 
-	DB.SqliteDb = db
-	return nil
+// stateDialector 按驱动构造状态库的 GORM 方言
+func stateDialector(cfg config.StateConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case config.StateDriverSQLite:
+		// 确保目录存在
+		if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create state directory: %w", err)
+		}
+		return sqlite.Open(cfg.Path), nil
+	case config.StateDriverMySQL:
+		dsn, err := mysqldriver.ParseDSN(cfg.DSN)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state DSN: %w", err)
+		}
+		// 时间列需解析为 time.Time
+		dsn.ParseTime = true
+		return mysql.Open(dsn.FormatDSN()), nil
+	case config.StateDriverPostgres:
+		return postgres.Open(cfg.DSN), nil
+	default:
+		return nil, fmt.Errorf("unknown state driver %q", cfg.Driver)
+	}
 }
 
 // 关闭数据库连接
 func (d *Database) Close() error {
-	sqlDB, err := d.SqliteDb.DB()
+	sqlDB, err := d.StateDb.DB()
 	if err != nil {
 		return err
 	}
 	return sqlDB.Close()
 }
 
-// 创建用户应用关联
-func (d *Database) CreateProxyUserApp(userApp *model.ProxyUserApp) error {
-	if userApp.ID == 0 {
-		return d.SqliteDb.Create(userApp).Error
+// 记录用户在应用上的下游账号ID，数字ID同时写入 app_user_id
+func (d *Database) SetProxyUserAppRemoteID(ctx context.Context, user model.UserKey, appID uint64, remoteID string) error {
+	appUserID, _ := strconv.ParseUint(remoteID, 10, 64)
+	if err := whereUser(d.StateDb.WithContext(ctx).Model(&model.ProxyUserApp{}), user).
+		Where("app_id = ?", appID).
+		Updates(map[string]any{"app_user_id": appUserID, "app_user_ref": remoteID}).Error; err != nil {
+		return fmt.Errorf("failed to update app user ID for %s on app %d: %w", user, appID, err)
 	}
-	return d.SqliteDb.Save(userApp).Error
+	return nil
 }
 
-// 更具UserName更新sqlite
-func (d *Database) UpdateProxyUser(userApps []model.ProxyUserApp) error {
-	// 检查UserName是否存在
-	userName := userApps[0].UserName
-	exists, err := d.CheckProxyUserNameExists(userName)
-	if err != nil {
-		return fmt.Errorf("failed to check user name existence: %w", err)
+// 保存最近一次下游同步结果
+func (d *Database) UpdateProxyUserAppSyncState(ctx context.Context, user model.UserKey, appID uint64, state model.SyncState) error {
+	if err := whereUser(d.StateDb.WithContext(ctx).Model(&model.ProxyUserApp{}), user).
+		Where("app_id = ?", appID).
+		Select("sync_status", "sync_code", "sync_message", "sync_latency_ms", "sync_attempts", "sync_date").
+		Updates(model.ProxyUserApp{SyncState: state}).Error; err != nil {
+		return fmt.Errorf("failed to update sync state for %s on app %d: %w", user, appID, err)
 	}
-	if exists {
-		// 如果存在，则删除记录
-		if err := d.SqliteDb.Where("user_name = ?", userName).Delete(&model.ProxyUserApp{}).Error; err != nil {
-			return fmt.Errorf("failed to delete existing user app: %w", err)
-		}
+	return nil
+}
+
+// 获取用户尚未移除的应用映射
+func (d *Database) GetProxyUserApps(ctx context.Context, user model.UserKey) ([]model.ProxyUserApp, error) {
+	var apps []model.ProxyUserApp
+	if err := whereUser(d.StateDb.WithContext(ctx), user).Where("delete_mark = 0").Find(&apps).Error; err != nil {
+		return nil, fmt.Errorf("failed to get apps of user %s: %w", user, err)
 	}
-	for _, userApp := range userApps {
-		if err := d.CreateProxyUserApp(&userApp); err != nil {
-			return fmt.Errorf("failed to create user app: %w", err)
+	return apps, nil
+}
+
+// 获取用户尚未移除的应用映射，包括因禁用而停用的
+func (d *Database) GetUnremovedProxyUserApps(ctx context.Context, user model.UserKey) ([]model.ProxyUserApp, error) {
+	var apps []model.ProxyUserApp
+	if err := whereUser(d.StateDb.WithContext(ctx), user).Where("delete_mark <> ?", model.DeleteMarkRemoved).Find(&apps).Error; err != nil {
+		return nil, fmt.Errorf("failed to get apps of user %s: %w", user, err)
+	}
+	return apps, nil
+}
+
+// 获取用户在指定应用上尚未移除的映射，包括因禁用而停用的
+func (d *Database) GetProxyUserAppsByAppIDs(ctx context.Context, user model.UserKey, appIDs []uint64) ([]model.ProxyUserApp, error) {
+	var apps []model.ProxyUserApp
+	if err := whereUser(d.StateDb.WithContext(ctx), user).Where("app_id IN ? AND delete_mark <> ?", appIDs, model.DeleteMarkRemoved).Find(&apps).Error; err != nil {
+		return nil, fmt.Errorf("failed to get apps %v of user %s: %w", appIDs, user, err)
+	}
+	return apps, nil
+}
+
+// 下游同步成功后更新映射中保存的账号和资料
+func (d *Database) UpdateProxyUserAppProfile(ctx context.Context, user model.UserKey, appID uint64, profile model.ProxyUserApp) error {
+	if err := whereUser(d.StateDb.WithContext(ctx).Model(&model.ProxyUserApp{}), user).
+		Where("app_id = ?", appID).
+		Select(append([]string{"user_name"}, profileColumns...)).
+		Updates(profile).Error; err != nil {
+		return fmt.Errorf("failed to update profile of %s on app %d: %w", user, appID, err)
+	}
+	return nil
+}
+
+// 获取应用上尚未移除的映射，users 为空时返回全部
+func (d *Database) GetProxyUserAppsByApp(ctx context.Context, appID uint64, users []model.UserKey) ([]model.ProxyUserApp, error) {
+	var apps []model.ProxyUserApp
+	query := d.StateDb.WithContext(ctx).Where("app_id = ? AND delete_mark = 0", appID)
+	if len(users) > 0 {
+		// 未知用户ID的旧映射按账号匹配，见 whereUser；空列表按 IN (NULL) 不匹配
+		var ids []uint64
+		var userNames []string
+		for _, user := range users {
+			if user.ID == 0 {
+				userNames = append(userNames, user.UserName)
+			} else {
+				ids = append(ids, user.ID)
+			}
 		}
+		query = query.Where("(user_id IN ? OR (user_id = 0 AND user_name IN ?))", ids, userNames)
+	}
+	if err := query.Find(&apps).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user apps of app %d: %w", appID, err)
+	}
+	return apps, nil
+}
+
+// 标记用户在应用中的映射已移除；下游账号已删除，同时清除其ID，再次授权时重新开通
+func (d *Database) MarkProxyUserAppRemoved(ctx context.Context, user model.UserKey, appID uint64) error {
+	if err := whereUser(d.StateDb.WithContext(ctx).Model(&model.ProxyUserApp{}), user).
+		Where("app_id = ?", appID).
+		Updates(map[string]any{"delete_mark": model.DeleteMarkRemoved, "app_user_id": 0, "app_user_ref": ""}).Error; err != nil {
+		return fmt.Errorf("failed to mark app %d of user %s removed: %w", appID, user, err)
 	}
 	return nil
 }
 
-// 检测UserName是否存在
-func (d *Database) CheckProxyUserNameExists(userName string) (bool, error) {
-	var count int64
-	if err := d.SqliteDb.Model(&model.ProxyUserApp{}).Where("user_name = ?", userName).Count(&count).Error; err != nil {
-		return false, fmt.Errorf("failed to check user name existence: %w", err)
+// 标记用户在应用中的映射已停用，保留下游账号ID以便重新启用；
+// 下游以删除代替停用时 accountDeleted 为 true，同时清除其ID
+func (d *Database) MarkProxyUserAppDisabled(ctx context.Context, user model.UserKey, appID uint64, accountDeleted bool) error {
+	updates := map[string]any{"delete_mark": model.DeleteMarkDisabled}
+	if accountDeleted {
+		updates["app_user_id"], updates["app_user_ref"] = 0, ""
 	}
-	return count > 0, nil
+	if err := whereUser(d.StateDb.WithContext(ctx).Model(&model.ProxyUserApp{}), user).
+		Where("app_id = ?", appID).
+		Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to mark app %d of user %s disabled: %w", appID, user, err)
+	}
+	return nil
 }
 
-// 根据UserName获取应用列表
-func (d *Database) GetAppsByUserID(userID uint64) ([]model.ProxyUserApp, error) {
+// 获取用户因禁用而停用的应用映射
+func (d *Database) GetDisabledProxyUserApps(ctx context.Context, user model.UserKey) ([]model.ProxyUserApp, error) {
 	var apps []model.ProxyUserApp
-	if err := d.SqliteDb.Where("user_id = ?", userID).Find(&apps).Error; err != nil {
-		return nil, fmt.Errorf("failed to get apps by user ID %d: %w", userID, err)
+	if err := whereUser(d.StateDb.WithContext(ctx), user).Where("delete_mark = ?", model.DeleteMarkDisabled).Find(&apps).Error; err != nil {
+		return nil, fmt.Errorf("failed to get disabled apps of user %s: %w", user, err)
 	}
 	return apps, nil
 }
 
-func (d *Database) CheckConnection() error {
+func (d *Database) CheckConnection(ctx context.Context) error {
 	josDB, err := d.JosDb.DB()
 	if err != nil {
 		return err
 	}
-	if err := josDB.Ping(); err != nil {
+	if err := josDB.PingContext(ctx); err != nil {
 		return fmt.Errorf("failed to ping JOS database: %v", err)
 	}
 
-	sqlDB, err := d.SqliteDb.DB()
+	sqlDB, err := d.StateDb.DB()
 	if err != nil {
 		return err
 	}
-	return sqlDB.Ping()
+	return sqlDB.PingContext(ctx)
 }
 
-func (d *Database) GetJosAppIDByID(id uint64) (uint64, error) {
+// 根据主键获取应用
+func (d *Database) GetJosAppByID(ctx context.Context, id uint64) (model.JosApp, error) {
 	var app model.JosApp
-	if err := d.JosDb.Select("app_id").Where("id = ?", id).First(&app).Error; err != nil {
+	if err := d.JosDb.WithContext(ctx).Where("id = ?", id).First(&app).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return model.JosApp{}, fmt.Errorf("application with ID %d not found", id)
+		}
+		return model.JosApp{}, fmt.Errorf("failed to query app with ID %d: %w", id, err)
+	}
+	return app, nil
+}
+
+func (d *Database) GetJosAppIDByID(ctx context.Context, id uint64) (uint64, error) {
+	var app model.JosApp
+	if err := d.JosDb.WithContext(ctx).Select("app_id").Where("id = ?", id).First(&app).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return 0, fmt.Errorf("app with ID %d not found", id)
 		}
@@ -196,9 +354,9 @@ func (d *Database) GetJosAppIDByID(id uint64) (uint64, error) {
 	return app.AppID, nil
 }
 
-func (d *Database) GetUserByID(userID uint64) (model.XjrUser, error) {
+func (d *Database) GetUserByID(ctx context.Context, userID uint64) (model.XjrUser, error) {
 	var user model.XjrUser
-	if err := d.JosDb.First(&user, userID).Error; err != nil {
+	if err := d.JosDb.WithContext(ctx).First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return model.XjrUser{}, fmt.Errorf("user with ID %d not found", userID)
 		}
@@ -206,3 +364,15 @@ func (d *Database) GetUserByID(userID uint64) (model.XjrUser, error) {
 	}
 	return user, nil
 }
+
+// GetUserByUserName returns the active user-center user with the userName.
+func (d *Database) GetUserByUserName(ctx context.Context, userName string) (model.XjrUser, error) {
+	var user model.XjrUser
+	if err := d.JosDb.WithContext(ctx).Where("user_name = ? AND delete_mark = 0", userName).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return model.XjrUser{}, fmt.Errorf("user %s not found", userName)
+		}
+		return model.XjrUser{}, fmt.Errorf("failed to get user %s: %w", userName, err)
+	}
+	return user, nil
+}
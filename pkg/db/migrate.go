@@ -0,0 +1,179 @@
+package db
+
+import (
+	"center/model"
+	"center/pkg/migrate"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 状态库的迁移文件，按驱动分目录：migrations/sqlite、mysql、postgres
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// NewStateMigrator returns the migrator of the proxy state database, using
+// the migrations of its driver. jos is the user-center database read by data
+// migrations; it may be nil when the migrator only reports status.
+func NewStateMigrator(state, jos *gorm.DB) (*migrate.Migrator, error) {
+	sub, err := fs.Sub(migrationFiles, path.Join("migrations", state.Dialector.Name()))
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := migrate.Load(sub, migrate.Migration{
+		Version: 2,
+		Name:    "backfill_user_id",
+		UpFunc: func(ctx context.Context, tx *gorm.DB) error {
+			return backfillProxyUserIDs(ctx, tx, jos)
+		},
+		// 补充的用户ID无需清除
+		DownFunc: func(context.Context, *gorm.DB) error { return nil },
+	})
+	if err != nil {
+		return nil, err
+	}
+	return migrate.New(state, migrations), nil
+}
+
+// MigrateState adopts a state database created before versioned migrations
+// existed, then applies the pending migrations up to target (0 means all),
+// holding the migration lock so that concurrently starting proxies migrate
+// the database once.
+func MigrateState(ctx context.Context, state *gorm.DB, m *migrate.Migrator, target uint64) ([]migrate.Migration, error) {
+	unlock, err := m.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if err := adoptLegacySchema(ctx, state, m); err != nil {
+		return nil, fmt.Errorf("failed to adopt existing state database: %w", err)
+	}
+	return m.Up(ctx, target)
+}
+
+// adoptLegacySchema 旧版本以 AutoMigrate 建立的库：先补齐到 0001 的表结构，再记为已执行 0001，
+// 之后的迁移照常执行
+func adoptLegacySchema(ctx context.Context, db *gorm.DB, m *migrate.Migrator) error {
+	initialized, err := m.Initialized(ctx)
+	if err != nil || initialized || !db.Migrator().HasTable(&model.ProxyUserApp{}) {
+		return err
+	}
+	// 添加 (账号, 应用) 唯一索引前清理重复的映射
+	if err := dedupeProxyUserApps(db); err != nil {
+		return err
+	}
+	if err := db.WithContext(ctx).AutoMigrate(&proxyUserAppV1{}, &syncJobV1{}); err != nil {
+		return err
+	}
+	// 新增的用户ID列在旧行上为 NULL，统一为 0（未知），由迁移 0002 补充
+	for _, table := range []string{"proxy_user_app", "proxy_sync_job"} {
+		if err := db.WithContext(ctx).Table(table).Where("user_id IS NULL").Update("user_id", 0).Error; err != nil {
+			return err
+		}
+	}
+	if err := m.Baseline(ctx, 1); err != nil {
+		return err
+	}
+	log.Printf("Adopted existing state database at migration version 1")
+	return nil
+}
+
+// proxyUserAppV1 迁移 0001 时的映射表结构，仅用于接管旧库，不随模型修改
+type proxyUserAppV1 struct {
+	ID            int64     `gorm:"column:id;primaryKey"`
+	UserID        uint64    `gorm:"column:user_id;index:idx_proxy_user_app_user_id"`
+	UserName      string    `gorm:"column:user_name;type:varchar(25);uniqueIndex:idx_proxy_user_app_user_app"`
+	Name          string    `gorm:"column:name;type:varchar(20);index:idx_proxy_user_app_name"`
+	Gender        int       `gorm:"column:gender"`
+	Mobile        string    `gorm:"column:mobile;type:varchar(255)"`
+	Email         string    `gorm:"column:email;type:varchar(60)"`
+	NickName      string    `gorm:"column:nick_name;type:varchar(50)"`
+	Code          string    `gorm:"column:code;type:varchar(20)"`
+	Avatar        string    `gorm:"column:avatar;type:varchar(2000)"`
+	Address       string    `gorm:"column:address;type:varchar(200)"`
+	TenantID      string    `gorm:"column:tenant_id;type:varchar(255)"`
+	AppID         uint64    `gorm:"column:app_id;not null;uniqueIndex:idx_proxy_user_app_user_app"`
+	AppAddress    string    `gorm:"column:app_address;type:varchar(255)"`
+	AppUserID     uint64    `gorm:"column:app_user_id"`
+	AppUserRef    string    `gorm:"column:app_user_ref;type:varchar(255)"`
+	DeleteMark    int       `gorm:"column:delete_mark;not null;default:0"`
+	SyncStatus    string    `gorm:"column:sync_status;type:varchar(20)"`
+	SyncCode      int       `gorm:"column:sync_code"`
+	SyncMessage   string    `gorm:"column:sync_message;type:varchar(255)"`
+	SyncLatencyMs int64     `gorm:"column:sync_latency_ms"`
+	SyncAttempts  int       `gorm:"column:sync_attempts"`
+	SyncDate      time.Time `gorm:"column:sync_date"`
+	CreateDate    time.Time `gorm:"column:create_date;default:CURRENT_TIMESTAMP"`
+	ModifyDate    time.Time `gorm:"column:modify_date"`
+}
+
+func (proxyUserAppV1) TableName() string {
+	return "proxy_user_app"
+}
+
+// syncJobV1 迁移 0001 时的同步任务表结构，仅用于接管旧库，不随模型修改
+type syncJobV1 struct {
+	ID             uint64    `gorm:"column:id;primaryKey;autoIncrement"`
+	UserID         uint64    `gorm:"column:user_id;index:idx_proxy_sync_job_user_id"`
+	UserName       string    `gorm:"column:user_name;type:varchar(25);index:idx_proxy_sync_job_user_name"`
+	AppID          uint64    `gorm:"column:app_id;not null;index:idx_proxy_sync_job_app_id"`
+	AppAddress     string    `gorm:"column:app_address;type:varchar(255)"`
+	Operation      string    `gorm:"column:operation;type:varchar(20);not null"`
+	IdempotencyKey string    `gorm:"column:idempotency_key;type:varchar(255);index:idx_proxy_sync_job_idempotency_key"`
+	Payload        string    `gorm:"column:payload;type:text"`
+	Status         string    `gorm:"column:status;type:varchar(20);not null;index:idx_proxy_sync_job_status"`
+	Attempts       int       `gorm:"column:attempts;not null;default:0"`
+	MaxAttempts    int       `gorm:"column:max_attempts;not null"`
+	NextRunAt      time.Time `gorm:"column:next_run_at;index:idx_proxy_sync_job_next_run_at"`
+	LastError      string    `gorm:"column:last_error;type:text"`
+	LastCode       int       `gorm:"column:last_code"`
+	LastMessage    string    `gorm:"column:last_message;type:varchar(255)"`
+	LatencyMs      int64     `gorm:"column:latency_ms"`
+	CreateDate     time.Time `gorm:"column:create_date;default:CURRENT_TIMESTAMP"`
+	ModifyDate     time.Time `gorm:"column:modify_date"`
+}
+
+func (syncJobV1) TableName() string {
+	return "proxy_sync_job"
+}
+
+// backfillProxyUserIDs 迁移 0002：为尚未记录用户ID的映射按账号补充用户中心的用户ID
+func backfillProxyUserIDs(ctx context.Context, state, jos *gorm.DB) error {
+	var userNames []string
+	if err := state.WithContext(ctx).Model(&model.ProxyUserApp{}).
+		Where("user_id = 0").Distinct().Pluck("user_name", &userNames).Error; err != nil {
+		return fmt.Errorf("failed to query mappings without user ID: %w", err)
+	}
+	if len(userNames) == 0 {
+		return nil
+	}
+	if jos == nil {
+		return fmt.Errorf("recording user IDs on %d users requires the user-center database", len(userNames))
+	}
+	var filled int64
+	for batch := range slices.Chunk(userNames, 500) {
+		var users []model.XjrUser
+		if err := jos.WithContext(ctx).Select("id", "user_name").
+			Where("user_name IN ? AND delete_mark = 0", batch).Find(&users).Error; err != nil {
+			return fmt.Errorf("failed to query users: %w", err)
+		}
+		for _, user := range users {
+			res := state.WithContext(ctx).Model(&model.ProxyUserApp{}).
+				Where("user_id = 0 AND user_name = ?", user.UserName).Update("user_id", user.ID)
+			if res.Error != nil {
+				return fmt.Errorf("failed to record user ID of %s: %w", user.UserName, res.Error)
+			}
+			filled += res.RowsAffected
+		}
+	}
+	log.Printf("Recorded user IDs on %d existing mappings", filled)
+	return nil
+}
@@ -0,0 +1,178 @@
+package db
+
+import (
+	"center/model"
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// openTestJos 用户中心库，只含测试用到的 xjr_user 列
+func openTestJos(t *testing.T, users ...model.XjrUser) *gorm.DB {
+	t.Helper()
+	jos := openTestDB(t, "jos.db")
+	if err := jos.Exec("CREATE TABLE xjr_user (id integer PRIMARY KEY, user_name varchar(25), delete_mark integer DEFAULT 0)").Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range users {
+		if err := jos.Exec("INSERT INTO xjr_user (id, user_name) VALUES (?, ?)", user.ID, user.UserName).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return jos
+}
+
+func TestMigrateStateFresh(t *testing.T) {
+	ctx := context.Background()
+	state := openTestDB(t, "state.db")
+	m, err := NewStateMigrator(state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 状态查询和校验不修改库
+	if _, err := m.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Verify(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if tables, _ := state.Migrator().GetTables(); len(tables) != 0 {
+		t.Fatalf("status and verify created tables %v", tables)
+	}
+
+	done, err := MigrateState(ctx, state, m, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) == 0 || done[len(done)-1].Version != m.Latest() {
+		t.Fatalf("MigrateState applied %d migrations, want up to %d", len(done), m.Latest())
+	}
+	for _, table := range []any{&model.ProxyUserApp{}, &model.SyncJob{}} {
+		if !state.Migrator().HasTable(table) {
+			t.Errorf("table of %T missing", table)
+		}
+	}
+}
+
+func TestMigrateStateAdoptsLegacySchema(t *testing.T) {
+	ctx := context.Background()
+	state := openTestDB(t, "state.db")
+	// 最初版本的映射表：没有用户ID列，且有重复的 (账号, 应用)
+	if err := state.Exec("CREATE TABLE proxy_user_app (id integer PRIMARY KEY AUTOINCREMENT, user_name varchar(25), name varchar(20), gender integer, mobile varchar(255), email varchar(60), app_id integer NOT NULL, app_address varchar(255), app_user_id integer, create_date datetime DEFAULT CURRENT_TIMESTAMP, modify_date datetime)").Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range []struct {
+		userName string
+		appID    uint64
+	}{{"alice", 1}, {"alice", 1}, {"alice", 2}, {"bob", 1}} {
+		if err := state.Exec("INSERT INTO proxy_user_app (user_name, app_id) VALUES (?, ?)", row.userName, row.appID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	jos := openTestJos(t, model.XjrUser{ID: 7, UserName: "alice"})
+
+	m, err := NewStateMigrator(state, jos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	state.Table("proxy_user_app").Count(&count)
+	if count != 4 || state.Migrator().HasTable("schema_migrations") {
+		t.Fatalf("status modified the legacy database")
+	}
+
+	if _, err := MigrateState(ctx, state, m, 0); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := m.Pending(ctx); err != nil || len(pending) != 0 {
+		t.Fatalf("Pending() after adoption = %v, %v", pending, err)
+	}
+	var apps []model.ProxyUserApp
+	if err := state.Order("user_name, app_id").Find(&apps).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 3 {
+		t.Fatalf("got %d mappings after adoption, want duplicates removed", len(apps))
+	}
+	for _, app := range apps {
+		want := uint64(0)
+		if app.UserName == "alice" {
+			want = 7
+		}
+		if app.UserID != want {
+			t.Errorf("user ID of %s on app %d = %d, want %d", app.UserName, app.AppID, app.UserID, want)
+		}
+	}
+}
+
+func TestMigrateStateRekeysByUserID(t *testing.T) {
+	ctx := context.Background()
+	state := openTestDB(t, "state.db")
+	m, err := NewStateMigrator(state, openTestJos(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateState(ctx, state, m, 2); err != nil {
+		t.Fatal(err)
+	}
+	// 改名前后的两条映射属于同一用户；用户ID为 0 的映射来自已不存在的用户
+	for _, app := range []model.ProxyUserApp{
+		{UserID: 1, UserName: "alice", AppID: 10},
+		{UserID: 1, UserName: "alice.new", AppID: 10},
+		{UserID: 1, UserName: "alice.new", AppID: 11},
+		{UserName: "gone", AppID: 10},
+		{UserName: "left", AppID: 10},
+	} {
+		if err := state.Create(&app).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := MigrateState(ctx, state, m, 3); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	if err := state.Model(&model.ProxyUserApp{}).Order("id").Pluck("user_name", &names).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice.new", "alice.new", "gone", "left"}; !slices.Equal(names, want) {
+		t.Errorf("mappings after rekey = %v, want %v", names, want)
+	}
+	// 唯一约束改为 (用户ID, 应用)：同名的新用户可以建立映射，用户ID为 0 的不受约束
+	for _, app := range []model.ProxyUserApp{{UserID: 2, UserName: "gone", AppID: 10}, {UserName: "gone", AppID: 10}} {
+		if err := state.Create(&app).Error; err != nil {
+			t.Errorf("creating %s (user %d) on app 10: %v", app.UserName, app.UserID, err)
+		}
+	}
+	if err := state.Create(&model.ProxyUserApp{UserID: 1, UserName: "alice", AppID: 10}).Error; err == nil {
+		t.Errorf("created a second mapping of user 1 on app 10")
+	}
+
+	// 回滚恢复 (账号, 应用) 唯一约束，同名映射只保留最新的一条
+	if _, err := m.Down(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	state.Model(&model.ProxyUserApp{}).Where("user_name = ? AND app_id = ?", "gone", 10).Count(&count)
+	if count != 1 {
+		t.Errorf("%d mappings of gone on app 10 after rollback, want 1", count)
+	}
+}
@@ -0,0 +1,61 @@
+-- 用户在下游应用的映射，每个 (账号, 应用) 一条
+CREATE TABLE `proxy_user_app` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `user_name` varchar(25),
+  `name` varchar(20),
+  `gender` bigint,
+  `mobile` varchar(255),
+  `email` varchar(60),
+  `nick_name` varchar(50),
+  `code` varchar(20),
+  `avatar` varchar(2000),
+  `address` varchar(200),
+  `tenant_id` varchar(255),
+  `app_id` bigint unsigned NOT NULL,
+  `app_address` varchar(255),
+  `app_user_id` bigint unsigned,
+  `app_user_ref` varchar(255),
+  `delete_mark` bigint NOT NULL DEFAULT 0,
+  `sync_status` varchar(20),
+  `sync_code` bigint,
+  `sync_message` varchar(255),
+  `sync_latency_ms` bigint,
+  `sync_attempts` bigint,
+  `sync_date` datetime(3) NULL,
+  `create_date` datetime(3) NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `modify_date` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_proxy_user_app_name` (`name`),
+  UNIQUE INDEX `idx_proxy_user_app_user_app` (`user_name`, `app_id`),
+  INDEX `idx_proxy_user_app_user_id` (`user_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- 下游应用用户同步任务（outbox）
+CREATE TABLE `proxy_sync_job` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `user_name` varchar(25),
+  `app_id` bigint unsigned NOT NULL,
+  `app_address` varchar(255),
+  `operation` varchar(20) NOT NULL,
+  `idempotency_key` varchar(255),
+  `payload` text,
+  `status` varchar(20) NOT NULL,
+  `attempts` bigint NOT NULL DEFAULT 0,
+  `max_attempts` bigint NOT NULL,
+  `next_run_at` datetime(3) NULL,
+  `last_error` text,
+  `last_code` bigint,
+  `last_message` varchar(255),
+  `latency_ms` bigint,
+  `create_date` datetime(3) NULL DEFAULT CURRENT_TIMESTAMP(3),
+  `modify_date` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_proxy_sync_job_user_id` (`user_id`),
+  INDEX `idx_proxy_sync_job_user_name` (`user_name`),
+  INDEX `idx_proxy_sync_job_app_id` (`app_id`),
+  INDEX `idx_proxy_sync_job_idempotency_key` (`idempotency_key`),
+  INDEX `idx_proxy_sync_job_status` (`status`),
+  INDEX `idx_proxy_sync_job_next_run_at` (`next_run_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
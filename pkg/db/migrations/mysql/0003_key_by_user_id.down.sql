@@ -0,0 +1,6 @@
+DROP INDEX `idx_proxy_user_app_user_name` ON `proxy_user_app`;
+DROP INDEX `idx_proxy_user_app_user_id_app` ON `proxy_user_app`;
+ALTER TABLE `proxy_user_app` DROP COLUMN `user_id_key`;
+-- 恢复 (账号, 应用) 唯一索引前清理重复的映射
+DELETE FROM `proxy_user_app` WHERE `id` NOT IN (SELECT `id` FROM (SELECT MAX(`id`) AS `id` FROM `proxy_user_app` GROUP BY `user_name`, `app_id`) AS `latest`);
+CREATE UNIQUE INDEX `idx_proxy_user_app_user_app` ON `proxy_user_app` (`user_name`, `app_id`);
@@ -0,0 +1,9 @@
+-- 映射按 (用户ID, 应用) 唯一：同名的新用户不再接管已删除用户的映射，改名也不与残留的映射冲突
+-- 同一 (用户ID, 应用) 只保留最新的一条映射；子查询包一层派生表，MySQL 不允许在删除的同时直接查询同一张表
+DELETE FROM `proxy_user_app` WHERE `user_id` <> 0 AND `id` NOT IN (SELECT `id` FROM (SELECT MAX(`id`) AS `id` FROM `proxy_user_app` WHERE `user_id` <> 0 GROUP BY `user_id`, `app_id`) AS `latest`);
+DROP INDEX `idx_proxy_user_app_user_app` ON `proxy_user_app`;
+-- 用户ID为 0 的旧映射在用户中心已不存在，按 NULL 处理不参与唯一约束；
+-- 以生成列代替函数索引（MySQL 8.0.13 起才支持），兼容 MySQL 5.7 和更早的 8.0
+ALTER TABLE `proxy_user_app` ADD COLUMN `user_id_key` bigint unsigned GENERATED ALWAYS AS (NULLIF(`user_id`, 0)) VIRTUAL;
+CREATE UNIQUE INDEX `idx_proxy_user_app_user_id_app` ON `proxy_user_app` (`user_id_key`, `app_id`);
+CREATE INDEX `idx_proxy_user_app_user_name` ON `proxy_user_app` (`user_name`);
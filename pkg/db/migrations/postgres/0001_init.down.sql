@@ -0,0 +1,2 @@
+DROP TABLE "proxy_sync_job";
+DROP TABLE "proxy_user_app";
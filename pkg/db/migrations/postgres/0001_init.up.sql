@@ -0,0 +1,59 @@
+-- 用户在下游应用的映射，每个 (账号, 应用) 一条
+CREATE TABLE "proxy_user_app" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint,
+  "user_name" varchar(25),
+  "name" varchar(20),
+  "gender" bigint,
+  "mobile" varchar(255),
+  "email" varchar(60),
+  "nick_name" varchar(50),
+  "code" varchar(20),
+  "avatar" varchar(2000),
+  "address" varchar(200),
+  "tenant_id" varchar(255),
+  "app_id" bigint NOT NULL,
+  "app_address" varchar(255),
+  "app_user_id" bigint,
+  "app_user_ref" varchar(255),
+  "delete_mark" bigint NOT NULL DEFAULT 0,
+  "sync_status" varchar(20),
+  "sync_code" bigint,
+  "sync_message" varchar(255),
+  "sync_latency_ms" bigint,
+  "sync_attempts" bigint,
+  "sync_date" timestamptz,
+  "create_date" timestamptz DEFAULT CURRENT_TIMESTAMP,
+  "modify_date" timestamptz
+);
+CREATE INDEX "idx_proxy_user_app_name" ON "proxy_user_app" ("name");
+CREATE UNIQUE INDEX "idx_proxy_user_app_user_app" ON "proxy_user_app" ("user_name", "app_id");
+CREATE INDEX "idx_proxy_user_app_user_id" ON "proxy_user_app" ("user_id");
+
+-- 下游应用用户同步任务（outbox）
+CREATE TABLE "proxy_sync_job" (
+  "id" bigserial PRIMARY KEY,
+  "user_id" bigint,
+  "user_name" varchar(25),
+  "app_id" bigint NOT NULL,
+  "app_address" varchar(255),
+  "operation" varchar(20) NOT NULL,
+  "idempotency_key" varchar(255),
+  "payload" text,
+  "status" varchar(20) NOT NULL,
+  "attempts" bigint NOT NULL DEFAULT 0,
+  "max_attempts" bigint NOT NULL,
+  "next_run_at" timestamptz,
+  "last_error" text,
+  "last_code" bigint,
+  "last_message" varchar(255),
+  "latency_ms" bigint,
+  "create_date" timestamptz DEFAULT CURRENT_TIMESTAMP,
+  "modify_date" timestamptz
+);
+CREATE INDEX "idx_proxy_sync_job_user_id" ON "proxy_sync_job" ("user_id");
+CREATE INDEX "idx_proxy_sync_job_user_name" ON "proxy_sync_job" ("user_name");
+CREATE INDEX "idx_proxy_sync_job_app_id" ON "proxy_sync_job" ("app_id");
+CREATE INDEX "idx_proxy_sync_job_idempotency_key" ON "proxy_sync_job" ("idempotency_key");
+CREATE INDEX "idx_proxy_sync_job_status" ON "proxy_sync_job" ("status");
+CREATE INDEX "idx_proxy_sync_job_next_run_at" ON "proxy_sync_job" ("next_run_at");
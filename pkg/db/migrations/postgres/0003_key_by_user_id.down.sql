@@ -0,0 +1,5 @@
+DROP INDEX "idx_proxy_user_app_user_name";
+DROP INDEX "idx_proxy_user_app_user_id_app";
+-- 恢复 (账号, 应用) 唯一索引前清理重复的映射
+DELETE FROM "proxy_user_app" WHERE "id" NOT IN (SELECT MAX("id") FROM "proxy_user_app" GROUP BY "user_name", "app_id");
+CREATE UNIQUE INDEX "idx_proxy_user_app_user_app" ON "proxy_user_app" ("user_name", "app_id");
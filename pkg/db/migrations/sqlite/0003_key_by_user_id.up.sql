@@ -0,0 +1,7 @@
+-- 映射按 (用户ID, 应用) 唯一：同名的新用户不再接管已删除用户的映射，改名也不与残留的映射冲突
+-- 同一 (用户ID, 应用) 只保留最新的一条映射
+DELETE FROM `proxy_user_app` WHERE `user_id` <> 0 AND `id` NOT IN (SELECT MAX(`id`) FROM `proxy_user_app` WHERE `user_id` <> 0 GROUP BY `user_id`, `app_id`);
+DROP INDEX `idx_proxy_user_app_user_app`;
+-- 用户ID为 0 的旧映射在用户中心已不存在，不参与唯一约束
+CREATE UNIQUE INDEX `idx_proxy_user_app_user_id_app` ON `proxy_user_app`(`user_id`,`app_id`) WHERE `user_id` <> 0;
+CREATE INDEX `idx_proxy_user_app_user_name` ON `proxy_user_app`(`user_name`);
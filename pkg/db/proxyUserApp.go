@@ -0,0 +1,141 @@
+package db
+
+import (
+	"center/model"
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 映射中的用户资料列
+var profileColumns = []string{"name", "gender", "mobile", "email", "nick_name", "code", "avatar", "address", "tenant_id"}
+
+// mergeColumns 合并时更新的列：用户ID、账号、用户资料、应用地址和移除标记
+var mergeColumns = append([]string{"user_id", "user_name", "app_address", "delete_mark"}, profileColumns...)
+
+// whereUser 按用户ID匹配映射；用户ID为 0 的是迁移时在用户中心找不到的旧映射，只能按账号匹配，
+// 不会匹配到之后同名的新用户
+func whereUser(tx *gorm.DB, user model.UserKey) *gorm.DB {
+	if user.ID == 0 {
+		return tx.Where("user_id = 0 AND user_name = ?", user.UserName)
+	}
+	return tx.Where("user_id = ?", user.ID)
+}
+
+// ProxyUserAppMerge 一个用户的映射变更
+type ProxyUserAppMerge struct {
+	User model.UserKey
+	// 按 (用户, 应用) 新增或更新账号、资料和地址，已有的下游账号ID和同步状态保留；
+	// 用户改名时更新原映射的账号，不新增映射
+	Upsert []model.ProxyUserApp
+	// 删除这些应用上的映射
+	RemoveAppIDs []uint64
+}
+
+// MergeResult 合并结果
+type MergeResult struct {
+	Apps    []model.ProxyUserApp // Upsert 合并后的映射，顺序与 Upsert 一致
+	Added   []model.ProxyUserApp // 新增的映射
+	Changed []model.ProxyUserApp // 账号、资料、地址或移除标记有变化的映射（合并后的值）
+	Removed []model.ProxyUserApp // 删除的映射（删除前的值）
+}
+
+// MergeProxyUserApps applies the merge to the user's mappings in one
+// transaction, leaving the mappings of the user's other apps untouched, and
+// reports exactly which mappings were added, changed and removed.
+func (d *Database) MergeProxyUserApps(ctx context.Context, m ProxyUserAppMerge) (MergeResult, error) {
+	if m.User.ID == 0 {
+		return MergeResult{}, fmt.Errorf("cannot merge mappings of %s without a user ID", m.User.UserName)
+	}
+	var result MergeResult
+	err := d.StateDb.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing []model.ProxyUserApp
+		if err := whereUser(tx, m.User).Find(&existing).Error; err != nil {
+			return fmt.Errorf("failed to query mappings of %s: %w", m.User, err)
+		}
+		byApp := make(map[uint64]model.ProxyUserApp, len(existing))
+		for _, app := range existing {
+			byApp[app.AppID] = app
+		}
+
+		result = MergeResult{Apps: make([]model.ProxyUserApp, 0, len(m.Upsert))}
+		for _, app := range m.Upsert {
+			app.UserID, app.UserName = m.User.ID, m.User.UserName
+			old, ok := byApp[app.AppID]
+			if !ok {
+				app.DeleteMark = 0
+				// 并发请求已插入同一 (用户ID, 应用) 时更新该行
+				if err := tx.Clauses(clause.OnConflict{
+					Columns:     []clause.Column{{Name: "user_id"}, {Name: "app_id"}},
+					TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "user_id <> 0"}}},
+					DoUpdates:   clause.AssignmentColumns(mergeColumns),
+				}).Create(&app).Error; err != nil {
+					return fmt.Errorf("failed to add mapping of %s on app %d: %w", m.User, app.AppID, err)
+				}
+				result.Added = append(result.Added, app)
+			} else {
+				merged := mergeProxyUserApp(old, app)
+				if merged != old {
+					if err := tx.Model(&model.ProxyUserApp{}).Where("id = ?", old.ID).
+						Select(append([]string{"app_user_id", "app_user_ref"}, mergeColumns...)).
+						Updates(&merged).Error; err != nil {
+						return fmt.Errorf("failed to update mapping of %s on app %d: %w", m.User, app.AppID, err)
+					}
+					result.Changed = append(result.Changed, merged)
+				}
+				app = merged
+			}
+			byApp[app.AppID] = app
+			result.Apps = append(result.Apps, app)
+		}
+
+		var removeIDs []int64
+		for _, appID := range m.RemoveAppIDs {
+			if app, ok := byApp[appID]; ok {
+				removeIDs = append(removeIDs, app.ID)
+				result.Removed = append(result.Removed, app)
+				delete(byApp, appID)
+			}
+		}
+		if len(removeIDs) > 0 {
+			if err := tx.Where("id IN ?", removeIDs).Delete(&model.ProxyUserApp{}).Error; err != nil {
+				return fmt.Errorf("failed to remove mappings of %s: %w", m.User, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return MergeResult{}, err
+	}
+	return result, nil
+}
+
+// mergeProxyUserApp 以新的账号、资料和地址更新已有映射，新映射未带下游账号ID时保留原值
+func mergeProxyUserApp(old, app model.ProxyUserApp) model.ProxyUserApp {
+	merged := old
+	merged.UserID = app.UserID
+	merged.UserName = app.UserName
+	merged.Name, merged.Gender, merged.Mobile, merged.Email = app.Name, app.Gender, app.Mobile, app.Email
+	merged.NickName, merged.Code, merged.Avatar = app.NickName, app.Code, app.Avatar
+	merged.Address, merged.TenantID = app.Address, app.TenantID
+	merged.DeleteMark = 0
+	if app.AppAddress != "" {
+		merged.AppAddress = app.AppAddress
+	}
+	if app.AppUserID != 0 || app.AppUserRef != "" {
+		merged.AppUserID, merged.AppUserRef = app.AppUserID, app.AppUserRef
+	}
+	return merged
+}
+
+// dedupeProxyUserApps 每个 (账号, 应用) 只保留最新的一条映射，唯一索引建立后不再执行
+func dedupeProxyUserApps(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&model.ProxyUserApp{}) || m.HasIndex(&model.ProxyUserApp{}, "idx_proxy_user_app_user_app") {
+		return nil
+	}
+	// 子查询包一层派生表，MySQL 不允许在删除的同时直接查询同一张表
+	return db.Exec("DELETE FROM proxy_user_app WHERE id NOT IN (SELECT id FROM (SELECT MAX(id) AS id FROM proxy_user_app GROUP BY user_name, app_id) AS latest)").Error
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"center/model"
+	"context"
+	"testing"
+)
+
+// openTestState 执行全部迁移后的状态库
+func openTestState(t *testing.T) *Database {
+	t.Helper()
+	state := openTestDB(t, "state.db")
+	m, err := NewStateMigrator(state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateState(context.Background(), state, m, 0); err != nil {
+		t.Fatal(err)
+	}
+	return &Database{StateDb: state}
+}
+
+func TestMergeProxyUserAppsKeyedByUserID(t *testing.T) {
+	ctx := context.Background()
+	d := openTestState(t)
+	alice := model.UserKey{ID: 1, UserName: "alice"}
+	if _, err := d.MergeProxyUserApps(ctx, ProxyUserAppMerge{User: alice, Upsert: []model.ProxyUserApp{{AppID: 10}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SetProxyUserAppRemoteID(ctx, alice, 10, "remote-alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 改名后合并更新原映射，保留下游账号ID
+	renamed := model.UserKey{ID: 1, UserName: "alice2"}
+	result, err := d.MergeProxyUserApps(ctx, ProxyUserAppMerge{User: renamed, Upsert: []model.ProxyUserApp{{AppID: 10}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Added) != 0 || len(result.Changed) != 1 || result.Apps[0].UserName != "alice2" || result.Apps[0].AppUserRef != "remote-alice" {
+		t.Fatalf("rename merge = %+v", result)
+	}
+
+	// 使用原账号的新用户新增自己的映射，不接管原用户的下游账号
+	newAlice := model.UserKey{ID: 2, UserName: "alice"}
+	result, err = d.MergeProxyUserApps(ctx, ProxyUserAppMerge{User: newAlice, Upsert: []model.ProxyUserApp{{AppID: 10}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Added) != 1 || result.Apps[0].AppUserRef != "" {
+		t.Fatalf("merge of a new user with a reused name = %+v", result)
+	}
+
+	if _, err := d.MergeProxyUserApps(ctx, ProxyUserAppMerge{User: model.UserKey{UserName: "bob"}}); err == nil {
+		t.Errorf("merge without a user ID succeeded")
+	}
+}
+
+func TestMergeProxyUserAppsAfterRemoval(t *testing.T) {
+	ctx := context.Background()
+	d := openTestState(t)
+	alice := model.UserKey{ID: 1, UserName: "alice"}
+	for _, appID := range []uint64{10, 11} {
+		if _, err := d.MergeProxyUserApps(ctx, ProxyUserAppMerge{User: alice, Upsert: []model.ProxyUserApp{{AppID: appID}}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.SetProxyUserAppRemoteID(ctx, alice, appID, "remote"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 10 上的下游账号已删除，11 上的只是停用
+	if err := d.MarkProxyUserAppRemoved(ctx, alice, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.MarkProxyUserAppDisabled(ctx, alice, 11, false); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := d.MergeProxyUserApps(ctx, ProxyUserAppMerge{User: alice, Upsert: []model.ProxyUserApp{{AppID: 10}, {AppID: 11}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := result.Apps[0]; got.DeleteMark != 0 || got.AppUserRef != "" {
+		t.Errorf("regrant after delete = %+v, want no downstream account", got)
+	}
+	if got := result.Apps[1]; got.DeleteMark != 0 || got.AppUserRef != "remote" {
+		t.Errorf("regrant after disable = %+v, want the disabled account", got)
+	}
+}
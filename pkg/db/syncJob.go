@@ -0,0 +1,95 @@
+package db
+
+import (
+	"center/model"
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 批量写入同步任务，同一幂等键下尚未执行的旧任务标记为已被取代
+func (d *Database) CreateSyncJobs(ctx context.Context, jobs []model.SyncJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	return d.StateDb.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&jobs).Error; err != nil {
+			return fmt.Errorf("failed to create sync jobs: %w", err)
+		}
+		for _, job := range jobs {
+			if job.IdempotencyKey == "" {
+				continue
+			}
+			if err := tx.Model(&model.SyncJob{}).
+				Where("idempotency_key = ? AND status = ? AND id < ?", job.IdempotencyKey, model.SyncJobPending, job.ID).
+				Updates(map[string]any{
+					"status":       model.SyncJobSuperseded,
+					"last_message": fmt.Sprintf("superseded by job %d", job.ID),
+				}).Error; err != nil {
+				return fmt.Errorf("failed to supersede sync jobs of %s: %w", job.IdempotencyKey, err)
+			}
+		}
+		return nil
+	})
+}
+
+// 领取到期的待执行任务，并将其标记为执行中
+func (d *Database) ClaimDueSyncJobs(ctx context.Context, now time.Time, limit int) ([]model.SyncJob, error) {
+	var due []model.SyncJob
+	if err := d.StateDb.WithContext(ctx).Where("status = ? AND next_run_at <= ?", model.SyncJobPending, now).
+		Order("next_run_at").Limit(limit).Find(&due).Error; err != nil {
+		return nil, fmt.Errorf("failed to query due sync jobs: %w", err)
+	}
+
+	claimed := due[:0]
+	for _, job := range due {
+		result := d.StateDb.WithContext(ctx).Model(&model.SyncJob{}).
+			Where("id = ? AND status = ?", job.ID, model.SyncJobPending).
+			Update("status", model.SyncJobRunning)
+		if result.Error != nil {
+			return claimed, fmt.Errorf("failed to claim sync job %d: %w", job.ID, result.Error)
+		}
+		if result.RowsAffected == 1 {
+			job.Status = model.SyncJobRunning
+			claimed = append(claimed, job)
+		}
+	}
+	return claimed, nil
+}
+
+// 更新任务执行结果（状态、次数、下次执行时间、错误信息）
+func (d *Database) SaveSyncJobResult(ctx context.Context, job *model.SyncJob) error {
+	if err := d.StateDb.WithContext(ctx).Model(job).Select("status", "attempts", "next_run_at", "last_error", "last_code", "last_message", "latency_ms", "modify_date").Updates(job).Error; err != nil {
+		return fmt.Errorf("failed to update sync job %d: %w", job.ID, err)
+	}
+	return nil
+}
+
+// 将 before 之前开始执行、仍在执行中的任务重新置为待执行
+func (d *Database) ResetRunningSyncJobs(ctx context.Context, before time.Time) (int64, error) {
+	result := d.StateDb.WithContext(ctx).Model(&model.SyncJob{}).
+		Where("status = ? AND modify_date < ?", model.SyncJobRunning, before).
+		Update("status", model.SyncJobPending)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to reset running sync jobs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// 按状态统计同步任务数
+func (d *Database) CountSyncJobsByStatus(ctx context.Context) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := d.StateDb.WithContext(ctx).Model(&model.SyncJob{}).Select("status, count(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to count sync jobs: %w", err)
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"center/model"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCreateSyncJobsSupersedesAcrossOperations(t *testing.T) {
+	ctx := context.Background()
+	d := openTestState(t)
+	alice := model.UserKey{ID: 1, UserName: "alice"}
+	job := func(appID uint64, operation string) model.SyncJob {
+		return model.SyncJob{
+			UserID: alice.ID, UserName: alice.UserName, AppID: appID, Operation: operation,
+			IdempotencyKey: model.SyncJobKey(alice, appID), Status: model.SyncJobPending,
+			MaxAttempts: 3, NextRunAt: time.Now(),
+		}
+	}
+	revoke, other := job(10, model.SyncOpDelete), job(11, model.SyncOpDelete)
+	if err := d.CreateSyncJobs(ctx, []model.SyncJob{revoke, other}); err != nil {
+		t.Fatal(err)
+	}
+	// 再次授权的创建任务取代尚未执行的收回任务，其他应用的任务不受影响
+	if err := d.CreateSyncJobs(ctx, []model.SyncJob{job(10, model.SyncOpCreate)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var jobs []model.SyncJob
+	if err := d.StateDb.Order("id").Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	want := []string{model.SyncJobSuperseded, model.SyncJobPending, model.SyncJobPending}
+	for i, j := range jobs {
+		if j.Status != want[i] {
+			t.Errorf("job %d (%s on app %d) status = %s, want %s", j.ID, j.Operation, j.AppID, j.Status, want[i])
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package endpoint
+
+import (
+	"bytes"
+	"center/model"
+	"center/pkg/config"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// SkipError 应用不参与同步，Reason 说明原因
+type SkipError struct {
+	AppID  uint64
+	Reason string
+}
+
+func (e *SkipError) Error() string {
+	return fmt.Sprintf("app %d skipped: %s", e.AppID, e.Reason)
+}
+
+// rule 合并全局、环境和应用配置后的地址规则
+type rule struct {
+	prefer   string
+	fallback bool
+	path     *template.Template // 为 nil 时地址即同步地址
+}
+
+// probe 地址可达检测结果
+type probe struct {
+	ok        bool
+	checkedAt time.Time
+}
+
+// Resolver 由 jos_app 解析下游应用的同步地址
+type Resolver struct {
+	cfg   config.EndpointConfig
+	apps  map[uint64]config.AppConfig
+	paths map[string]*template.Template // 按模板文本缓存编译结果
+	dial  func(ctx context.Context, network, address string) (net.Conn, error)
+	now   func() time.Time
+
+	mu     sync.Mutex
+	probes map[string]probe
+	// 已记录过被状态过滤的 (应用, 状态)，每个只记录一次日志
+	filtered map[string]bool
+}
+
+// NewResolver compiles the path templates of the global, environment and app
+// settings, reporting every template that fails to parse or render.
+func NewResolver(cfg config.EndpointConfig, apps map[uint64]config.AppConfig) (*Resolver, error) {
+	r := &Resolver{
+		cfg:      cfg,
+		apps:     apps,
+		paths:    make(map[string]*template.Template),
+		dial:     (&net.Dialer{}).DialContext,
+		now:      time.Now,
+		probes:   make(map[string]probe),
+		filtered: make(map[string]bool),
+	}
+	var errs []string
+	compile := func(name, text string) {
+		if err := r.compile(text); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	compile("endpoints.path", cfg.Path)
+	for envID, env := range cfg.Environments {
+		compile(fmt.Sprintf("endpoints.environments.%d.path", envID), env.Path)
+	}
+	for appID, app := range apps {
+		compile(fmt.Sprintf("apps.%d.endpoint.path", appID), app.Endpoint.Path)
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid endpoint path: %s", strings.Join(errs, "; "))
+	}
+	return r, nil
+}
+
+// compile 编译路径模板，并以空应用渲染一次以检查字段名
+func (r *Resolver) compile(text string) error {
+	if text == "" || r.paths[text] != nil {
+		return nil
+	}
+	tmpl, err := template.New("path").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, pathData(model.JosApp{})); err != nil {
+		return err
+	}
+	r.paths[text] = tmpl
+	return nil
+}
+
+// pathData 路径模板可引用的应用字段
+func pathData(app model.JosApp) map[string]any {
+	return map[string]any{
+		"id":          app.ID,
+		"appId":       app.AppID,
+		"envId":       app.EnvID,
+		"workspaceId": app.WorkspaceID,
+		"projectId":   app.ProjectID,
+		"appName":     app.AppName,
+	}
+}
+
+// Resolve returns the sync URL of the app: the path template joined to the
+// preferred address, or to the other address when fallback is enabled and the
+// preferred one is missing or unreachable. Apps whose status is not accepted,
+// or that have no usable address, are reported with a *SkipError.
+func (r *Resolver) Resolve(ctx context.Context, app model.JosApp) (string, error) {
+	if !r.statusAccepted(app.Status) {
+		r.logFiltered(app)
+		return "", &SkipError{AppID: app.AppID, Reason: fmt.Sprintf("status %q is not one of %s", app.Status, strings.Join(r.cfg.Statuses, ", "))}
+	}
+
+	rl := r.rule(app)
+	addresses := map[string]string{
+		config.AddressInside:  strings.TrimSpace(app.PublishAddressInside),
+		config.AddressOutside: strings.TrimSpace(app.PublishAddressOutside),
+	}
+	other := config.AddressOutside
+	if rl.prefer == config.AddressOutside {
+		other = config.AddressInside
+	}
+
+	address := addresses[rl.prefer]
+	switch {
+	case address == "" && addresses[other] == "":
+		return "", &SkipError{AppID: app.AppID, Reason: "no publish address"}
+	case address == "" && !rl.fallback:
+		return "", &SkipError{AppID: app.AppID, Reason: fmt.Sprintf("no %s publish address and fallback is disabled", rl.prefer)}
+	case address == "":
+		address = addresses[other]
+	case rl.fallback && addresses[other] != "":
+		if err := r.reachable(ctx, address); err != nil {
+			log.Printf("App %d %s address %s unreachable, using %s address: %v", app.AppID, rl.prefer, address, other, err)
+			address = addresses[other]
+		}
+	}
+	return join(address, rl.path, app)
+}
+
+// statusAccepted 状态是否在允许同步的列表中
+func (r *Resolver) statusAccepted(status string) bool {
+	if len(r.cfg.Statuses) == 0 {
+		return true
+	}
+	for _, s := range r.cfg.Statuses {
+		if strings.EqualFold(strings.TrimSpace(status), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// logFiltered 应用因状态不在 endpoints.statuses 中不参与同步时记录日志，便于发现配置遗漏的状态
+func (r *Resolver) logFiltered(app model.JosApp) {
+	key := fmt.Sprintf("%d:%s", app.AppID, app.Status)
+	r.mu.Lock()
+	logged := r.filtered[key]
+	r.filtered[key] = true
+	r.mu.Unlock()
+	if !logged {
+		log.Printf("App %d (%s) is not synced: status %q is not in endpoints.statuses %v", app.AppID, app.AppName, app.Status, r.cfg.Statuses)
+	}
+}
+
+// rule 依次应用全局、环境和应用的地址规则
+func (r *Resolver) rule(app model.JosApp) rule {
+	rl := rule{prefer: r.cfg.Prefer, fallback: r.cfg.Fallback, path: r.paths[r.cfg.Path]}
+	for _, o := range []config.EndpointOverride{r.cfg.Environments[app.EnvID], r.apps[app.AppID].Endpoint} {
+		if o.Prefer != "" {
+			rl.prefer = o.Prefer
+		}
+		if o.Fallback != nil {
+			rl.fallback = *o.Fallback
+		}
+		if o.Path != "" {
+			rl.path = r.paths[o.Path]
+		}
+	}
+	return rl
+}
+
+// reachable 以 TCP 连接检测地址是否可达，结果缓存 probeInterval
+func (r *Resolver) reachable(ctx context.Context, address string) error {
+	if r.cfg.ProbeTimeout <= 0 {
+		return nil
+	}
+	host, err := hostPort(address)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	p, ok := r.probes[host]
+	r.mu.Unlock()
+	if ok && r.now().Sub(p.checkedAt) < r.cfg.ProbeInterval {
+		if !p.ok {
+			return fmt.Errorf("%s was unreachable at %s", host, p.checkedAt.Format(time.RFC3339))
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.ProbeTimeout)
+	defer cancel()
+	conn, err := r.dial(ctx, "tcp", host)
+	if err == nil {
+		conn.Close()
+	}
+	r.mu.Lock()
+	r.probes[host] = probe{ok: err == nil, checkedAt: r.now()}
+	r.mu.Unlock()
+	return err
+}
+
+// hostPort 地址的 host:port，未指定端口时按协议取默认端口
+func hostPort(address string) (string, error) {
+	u, err := url.Parse(withScheme(address))
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// withScheme 未带协议的地址按 http 处理
+func withScheme(address string) string {
+	if strings.Contains(address, "://") {
+		return address
+	}
+	return "http://" + address
+}
+
+// join 将渲染后的路径拼接到地址后
+func join(address string, path *template.Template, app model.JosApp) (string, error) {
+	address = withScheme(address)
+	if path == nil {
+		return address, nil
+	}
+	var buf bytes.Buffer
+	if err := path.Execute(&buf, pathData(app)); err != nil {
+		return "", fmt.Errorf("failed to render sync path of app %d: %w", app.AppID, err)
+	}
+	rendered := strings.TrimLeft(buf.String(), "/")
+	if rendered == "" {
+		return address, nil
+	}
+	return strings.TrimRight(address, "/") + "/" + rendered, nil
+}
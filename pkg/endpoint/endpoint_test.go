@@ -0,0 +1,123 @@
+package endpoint
+
+import (
+	"center/model"
+	"center/pkg/config"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestResolve(t *testing.T) {
+	falseValue := false
+	cfg := config.EndpointConfig{
+		Prefer:        config.AddressInside,
+		Fallback:      true,
+		Path:          "/api/{{.appId}}/users",
+		ProbeTimeout:  time.Second,
+		ProbeInterval: time.Minute,
+		Environments:  map[uint64]config.EndpointOverride{2: {Prefer: config.AddressOutside}},
+	}
+	apps := map[uint64]config.AppConfig{9: {Endpoint: config.EndpointOverride{Fallback: &falseValue, Path: "sync"}}}
+	r, err := NewResolver(cfg, apps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// inside.test 不可达
+	r.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if address == "inside.test:80" {
+			return nil, errors.New("refused")
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	for _, tc := range []struct {
+		name string
+		app  model.JosApp
+		want string
+		skip bool
+	}{
+		{"preferred", model.JosApp{AppID: 1, Status: "anything", PublishAddressInside: "10.0.0.1:8080", PublishAddressOutside: "https://out.test"}, "http://10.0.0.1:8080/api/1/users", false},
+		{"unreachable falls back", model.JosApp{AppID: 1, PublishAddressInside: "inside.test", PublishAddressOutside: "https://out.test/"}, "https://out.test/api/1/users", false},
+		{"missing falls back", model.JosApp{AppID: 1, PublishAddressOutside: "https://out.test"}, "https://out.test/api/1/users", false},
+		{"environment prefers outside", model.JosApp{AppID: 1, EnvID: 2, PublishAddressInside: "in.test", PublishAddressOutside: "out.test"}, "http://out.test/api/1/users", false},
+		{"app path without fallback", model.JosApp{AppID: 9, PublishAddressInside: "inside.test", PublishAddressOutside: "out.test"}, "http://inside.test/sync", false},
+		{"app without fallback", model.JosApp{AppID: 9, PublishAddressOutside: "out.test"}, "", true},
+		{"no address", model.JosApp{AppID: 1}, "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := r.Resolve(context.Background(), tc.app)
+			var skip *SkipError
+			if tc.skip != errors.As(err, &skip) || (!tc.skip && err != nil) || got != tc.want {
+				t.Errorf("Resolve() = %q, %v, want %q (skip %v)", got, err, tc.want, tc.skip)
+			}
+		})
+	}
+}
+
+func TestResolveStatuses(t *testing.T) {
+	r, err := NewResolver(config.EndpointConfig{Statuses: []string{"published", "running"}, Prefer: config.AddressInside}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := model.JosApp{AppID: 1, PublishAddressInside: "in.test"}
+	for status, accepted := range map[string]bool{"Published": true, " running ": true, "stopped": false, "": false} {
+		app.Status = status
+		_, err := r.Resolve(context.Background(), app)
+		var skip *SkipError
+		if accepted == errors.As(err, &skip) {
+			t.Errorf("status %q: Resolve() error = %v, want accepted %v", status, err, accepted)
+		}
+	}
+}
+
+func TestNewResolverRejectsInvalidPaths(t *testing.T) {
+	for _, path := range []string{"{{.appId", "{{.unknown}}"} {
+		if _, err := NewResolver(config.EndpointConfig{Path: path}, nil); err == nil {
+			t.Errorf("NewResolver(path %q) succeeded", path)
+		}
+	}
+}
+
+func TestProbeCache(t *testing.T) {
+	r, err := NewResolver(config.EndpointConfig{Prefer: config.AddressInside, Fallback: true, ProbeTimeout: time.Second, ProbeInterval: time.Minute}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	dials, down := 0, true
+	r.dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dials++
+		if down {
+			return nil, errors.New("refused")
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+	app := model.JosApp{AppID: 1, PublishAddressInside: "in.test", PublishAddressOutside: "out.test"}
+	resolve := func(want string, wantDials int) {
+		t.Helper()
+		got, err := r.Resolve(context.Background(), app)
+		if err != nil || got != want || dials != wantDials {
+			t.Errorf("Resolve() = %q, %v after %d probes, want %q after %d", got, err, dials, want, wantDials)
+		}
+	}
+
+	// 不可达的结果在 probeInterval 内复用，不重复探测
+	resolve("http://out.test", 1)
+	down = false
+	now = now.Add(30 * time.Second)
+	resolve("http://out.test", 1)
+
+	// 缓存过期后重新探测，恢复使用优先地址
+	now = now.Add(30 * time.Second)
+	resolve("http://in.test", 2)
+	down = true
+	resolve("http://in.test", 2)
+}
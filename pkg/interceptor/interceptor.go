@@ -0,0 +1,276 @@
+package interceptor
+
+import (
+	"center/pkg/config"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Route 拦截器匹配的请求：方法、路径模板和 Content-Type
+// 路径模板按 "/" 分段，"{name}" 匹配任意单个分段，匹配值可通过 r.PathValue(name) 读取
+type Route struct {
+	Method      string
+	Path        string
+	ContentType string
+}
+
+func (rt Route) String() string {
+	if rt.ContentType != "" {
+		return fmt.Sprintf("%s %s (%s)", rt.Method, rt.Path, rt.ContentType)
+	}
+	return fmt.Sprintf("%s %s", rt.Method, rt.Path)
+}
+
+// Interceptor 拦截用户中心的特定请求
+// 具体拦截器实现 RequestInterceptor、ResponseInterceptor 之一或两者
+type Interceptor interface {
+	Name() string
+	Route() Route
+}
+
+// RequestInterceptor 在请求转发到用户中心之前执行，返回错误时请求不会被转发
+// 此时 Exchange 只包含请求部分
+type RequestInterceptor interface {
+	Interceptor
+	InterceptRequest(ex *Exchange) error
+}
+
+// ResponseInterceptor 在收到用户中心响应之后、写回客户端之前执行
+type ResponseInterceptor interface {
+	Interceptor
+	InterceptResponse(ex *Exchange) error
+}
+
+// Exchange 被拦截的请求及用户中心的响应，响应拦截器可修改 Header 和 ResponseBody
+// 同一请求的请求阶段和响应阶段共享同一个 Exchange，可通过 Values 传递数据
+type Exchange struct {
+	Request      *http.Request
+	Body         []byte
+	StatusCode   int
+	Header       http.Header
+	ResponseBody []byte
+	Values       map[string]any
+}
+
+// SetJSONField sets field on the JSON object response body, so response
+// interceptors can return extra data to the client.
+func (ex *Exchange) SetJSONField(field string, value any) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(ex.ResponseBody, &obj); err != nil || obj == nil {
+		return fmt.Errorf("response body is not a JSON object")
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", field, err)
+	}
+	obj[field] = raw
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response body: %w", err)
+	}
+	ex.ResponseBody = body
+	return nil
+}
+
+// RequestFunc 请求阶段的拦截处理函数
+type RequestFunc func(ex *Exchange) error
+
+// ResponseFunc 响应阶段的拦截处理函数
+type ResponseFunc func(ex *Exchange) error
+
+type requestFunc struct {
+	name  string
+	route Route
+	fn    RequestFunc
+}
+
+// New creates a RequestInterceptor from a name, a route and a handler function.
+func New(name string, route Route, fn RequestFunc) RequestInterceptor {
+	return &requestFunc{name: name, route: route, fn: fn}
+}
+
+func (f *requestFunc) Name() string { return f.name }
+
+func (f *requestFunc) Route() Route { return f.route }
+
+func (f *requestFunc) InterceptRequest(ex *Exchange) error { return f.fn(ex) }
+
+type responseFunc struct {
+	name  string
+	route Route
+	fn    ResponseFunc
+}
+
+// NewResponse creates a ResponseInterceptor from a name, a route and a handler function.
+func NewResponse(name string, route Route, fn ResponseFunc) ResponseInterceptor {
+	return &responseFunc{name: name, route: route, fn: fn}
+}
+
+func (f *responseFunc) Name() string { return f.name }
+
+func (f *responseFunc) Route() Route { return f.route }
+
+func (f *responseFunc) InterceptResponse(ex *Exchange) error { return f.fn(ex) }
+
+type twoPhaseFunc struct {
+	requestFunc
+	fn ResponseFunc
+}
+
+// NewTwoPhase creates an interceptor that runs before on the request and after on
+// the upstream response of the same exchange.
+func NewTwoPhase(name string, route Route, before RequestFunc, after ResponseFunc) Interceptor {
+	return &twoPhaseFunc{requestFunc: requestFunc{name: name, route: route, fn: before}, fn: after}
+}
+
+func (f *twoPhaseFunc) InterceptResponse(ex *Exchange) error { return f.fn(ex) }
+
+// Phase describes when ic runs: "request", "response" or "request+response".
+func Phase(ic Interceptor) string {
+	_, req := ic.(RequestInterceptor)
+	_, resp := ic.(ResponseInterceptor)
+	switch {
+	case req && resp:
+		return "request+response"
+	case resp:
+		return "response"
+	default:
+		return "request"
+	}
+}
+
+// routed 已应用配置覆盖的拦截器
+type routed struct {
+	ic       Interceptor
+	route    Route
+	segments []string
+}
+
+// Info 已启用拦截器的名称、生效路由和执行阶段
+type Info struct {
+	Name  string
+	Route Route
+	Phase string
+}
+
+// Registry 按路由分发请求到已启用的拦截器
+type Registry struct {
+	active []*routed
+}
+
+// NewRegistry builds a registry from the available interceptors, applying the
+// enable flags and route overrides from cfg. Unknown names in cfg are rejected.
+func NewRegistry(available []Interceptor, cfg map[string]config.InterceptorConfig) (*Registry, error) {
+	known := make(map[string]bool, len(available))
+	for _, ic := range available {
+		if known[ic.Name()] {
+			return nil, fmt.Errorf("duplicate interceptor %q", ic.Name())
+		}
+		known[ic.Name()] = true
+	}
+	var unknown []string
+	for name := range cfg {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown interceptors in config: %s", strings.Join(unknown, ", "))
+	}
+
+	reg := &Registry{}
+	for _, ic := range available {
+		route := ic.Route()
+		override, ok := cfg[ic.Name()]
+		if ok {
+			if override.Enabled != nil && !*override.Enabled {
+				continue
+			}
+			if override.Method != "" {
+				route.Method = override.Method
+			}
+			if override.Path != "" {
+				route.Path = override.Path
+			}
+			if override.ContentType != "" {
+				route.ContentType = override.ContentType
+			}
+		}
+		route.Method = strings.ToUpper(route.Method)
+		if !strings.HasPrefix(route.Path, "/") {
+			return nil, fmt.Errorf("interceptor %q: path %q must start with /", ic.Name(), route.Path)
+		}
+		reg.active = append(reg.active, &routed{
+			ic:       ic,
+			route:    route,
+			segments: splitPath(route.Path),
+		})
+	}
+	return reg, nil
+}
+
+// Active describes the enabled interceptors in registration order.
+func (reg *Registry) Active() []Info {
+	list := make([]Info, 0, len(reg.active))
+	for _, rt := range reg.active {
+		list = append(list, Info{Name: rt.ic.Name(), Route: rt.route, Phase: Phase(rt.ic)})
+	}
+	return list
+}
+
+// Match returns the interceptors whose route matches the request method, the
+// given (rewritten) path and the request Content-Type. Path parameters of the
+// matched templates are set on r.
+func (reg *Registry) Match(r *http.Request, path string) []Interceptor {
+	var matched []Interceptor
+	segments := splitPath(path)
+	for _, rt := range reg.active {
+		if rt.route.Method != "" && rt.route.Method != r.Method {
+			continue
+		}
+		if rt.route.ContentType != "" && !strings.Contains(r.Header.Get("Content-Type"), rt.route.ContentType) {
+			continue
+		}
+		params, ok := matchSegments(rt.segments, segments)
+		if !ok {
+			continue
+		}
+		for name, value := range params {
+			r.SetPathValue(name, value)
+		}
+		matched = append(matched, rt.ic)
+	}
+	return matched
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// matchSegments 按分段匹配路径模板，返回 {name} 参数
+func matchSegments(template, path []string) (map[string]string, bool) {
+	if len(template) != len(path) {
+		return nil, false
+	}
+	var params map[string]string
+	for i, seg := range template {
+		if name, ok := strings.CutPrefix(seg, "{"); ok && strings.HasSuffix(name, "}") {
+			if path[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[strings.TrimSuffix(name, "}")] = path[i]
+			continue
+		}
+		if seg != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
@@ -0,0 +1,95 @@
+package interceptor
+
+import (
+	"center/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func noop(ex *Exchange) error { return nil }
+
+func names(list []Interceptor) []string {
+	var out []string
+	for _, ic := range list {
+		out = append(out, ic.Name())
+	}
+	return out
+}
+
+func TestRegistryMatch(t *testing.T) {
+	disabled := false
+	reg, err := NewRegistry([]Interceptor{
+		New("add", Route{Method: "post", Path: "/user", ContentType: "application/json"}, noop),
+		NewResponse("grant", Route{Method: http.MethodPut, Path: "/user/{id}/apps"}, noop),
+		NewTwoPhase("delete", Route{Method: http.MethodDelete, Path: "/user"}, noop, noop),
+		New("off", Route{Method: http.MethodPost, Path: "/user"}, noop),
+	}, map[string]config.InterceptorConfig{
+		"delete": {Path: "/user/remove"},
+		"off":    {Enabled: &disabled},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		method, path, contentType string
+		want                      []string
+	}{
+		{http.MethodPost, "/user", "application/json; charset=utf-8", []string{"add"}},
+		{http.MethodPost, "/user", "text/plain", nil},
+		{http.MethodPut, "/user/42/apps", "", []string{"grant"}},
+		{http.MethodPut, "/user//apps", "", nil},
+		{http.MethodPut, "/user/42/apps/1", "", nil},
+		{http.MethodDelete, "/user", "", nil},
+		{http.MethodDelete, "/user/remove/", "", []string{"delete"}},
+	} {
+		r := httptest.NewRequest(tc.method, "/api"+tc.path, nil)
+		r.Header.Set("Content-Type", tc.contentType)
+		got := names(reg.Match(r, tc.path))
+		if len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) {
+			t.Errorf("Match(%s %s, %q) = %v, want %v", tc.method, tc.path, tc.contentType, got, tc.want)
+		}
+		if tc.path == "/user/42/apps" && r.PathValue("id") != "42" {
+			t.Errorf("path value id = %q, want 42", r.PathValue("id"))
+		}
+	}
+
+	phases := map[string]string{}
+	for _, info := range reg.Active() {
+		phases[info.Name] = info.Phase
+	}
+	if len(phases) != 3 || phases["add"] != "request" || phases["grant"] != "response" || phases["delete"] != "request+response" {
+		t.Errorf("active interceptors = %v", reg.Active())
+	}
+}
+
+func TestNewRegistryErrors(t *testing.T) {
+	add := New("add", Route{Method: http.MethodPost, Path: "/user"}, noop)
+	for name, tc := range map[string]struct {
+		available []Interceptor
+		cfg       map[string]config.InterceptorConfig
+	}{
+		"duplicate":     {[]Interceptor{add, add}, nil},
+		"unknown":       {[]Interceptor{add}, map[string]config.InterceptorConfig{"nosuch": {}}},
+		"relative path": {[]Interceptor{add}, map[string]config.InterceptorConfig{"add": {Path: "user"}}},
+	} {
+		if _, err := NewRegistry(tc.available, tc.cfg); err == nil {
+			t.Errorf("%s: NewRegistry() succeeded", name)
+		}
+	}
+}
+
+func TestSetJSONField(t *testing.T) {
+	ex := &Exchange{ResponseBody: []byte(`{"code":1}`)}
+	if err := ex.SetJSONField("extra", []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(ex.ResponseBody); got != `{"code":1,"extra":[1]}` {
+		t.Errorf("body = %s", got)
+	}
+	ex.ResponseBody = []byte(`[1]`)
+	if err := ex.SetJSONField("extra", 1); err == nil {
+		t.Errorf("SetJSONField() on an array succeeded")
+	}
+}
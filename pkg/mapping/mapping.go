@@ -0,0 +1,214 @@
+// Package mapping builds outbound JSON payloads from a per-app template.
+//
+// A template is a YAML tree that mirrors the JSON the app expects. Objects and
+// arrays are copied as-is, non-string values are constants, and string values
+// are Go text/template expressions evaluated against the user record, e.g.
+//
+//	userName: "{{ .userName }}"
+//	sex: "{{ lookup \"gender\" .gender | default \"unknown\" }}"
+//	source: jos
+//	profile:
+//	  nick: "{{ .nickName }}"
+//
+// A string that consists of a single {{ }} action keeps the type of its value,
+// so "{{ .gender }}" renders as a JSON number. Anything else renders as a string.
+package mapping
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// node 模板中的一个值
+type node interface {
+	render(data any) (any, error)
+}
+
+type objectNode map[string]node
+
+type arrayNode []node
+
+type constNode struct{ value any }
+
+// textNode 渲染为字符串的模板
+type textNode struct{ tmpl *template.Template }
+
+// valueNode 单个 action 的模板，输出保留原值类型的 JSON
+type valueNode struct{ tmpl *template.Template }
+
+// Template 编译后的映射模板，可并发使用
+type Template struct {
+	root objectNode
+}
+
+// Compile compiles the template body. tables holds the lookup tables available
+// to the lookup function, keyed by table name and then by the printed value.
+func Compile(body map[string]any, tables map[string]map[string]any) (*Template, error) {
+	c := &compiler{funcs: funcs(tables)}
+	root, err := c.object("", body)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{root: root}, nil
+}
+
+// Render evaluates the template against data and returns the JSON object.
+func (t *Template) Render(data any) (map[string]any, error) {
+	out, err := t.root.render(data)
+	if err != nil {
+		return nil, err
+	}
+	return out.(map[string]any), nil
+}
+
+type compiler struct {
+	funcs template.FuncMap
+}
+
+func (c *compiler) compile(path string, value any) (node, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		return c.object(path, v)
+	case []any:
+		list := make(arrayNode, 0, len(v))
+		for i, item := range v {
+			n, err := c.compile(fmt.Sprintf("%s[%d]", path, i), item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, n)
+		}
+		return list, nil
+	case string:
+		return c.text(path, v)
+	default:
+		return constNode{value: v}, nil
+	}
+}
+
+func (c *compiler) object(path string, fields map[string]any) (objectNode, error) {
+	obj := make(objectNode, len(fields))
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		n, err := c.compile(join(path, key), fields[key])
+		if err != nil {
+			return nil, err
+		}
+		obj[key] = n
+	}
+	return obj, nil
+}
+
+func (c *compiler) text(path, text string) (node, error) {
+	if !strings.Contains(text, "{{") {
+		return constNode{value: text}, nil
+	}
+	tmpl, err := c.parse(path, text)
+	if err != nil {
+		return nil, err
+	}
+	// 仅包含一个 action 时输出原值，经 toJSON 保留类型
+	nodes := tmpl.Tree.Root.Nodes
+	if len(nodes) == 1 {
+		if action, ok := nodes[0].(*parse.ActionNode); ok && len(action.Pipe.Decl) == 0 {
+			valueTmpl, err := c.parse(path, "{{"+action.Pipe.String()+" | toJSON}}")
+			if err != nil {
+				return nil, err
+			}
+			return valueNode{tmpl: valueTmpl}, nil
+		}
+	}
+	return textNode{tmpl: tmpl}, nil
+}
+
+func (c *compiler) parse(path, text string) (*template.Template, error) {
+	tmpl, err := template.New(path).Option("missingkey=error").Funcs(c.funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+func (o objectNode) render(data any) (any, error) {
+	out := make(map[string]any, len(o))
+	for key, n := range o {
+		v, err := n.render(data)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+func (a arrayNode) render(data any) (any, error) {
+	out := make([]any, 0, len(a))
+	for _, n := range a {
+		v, err := n.render(data)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (n constNode) render(any) (any, error) {
+	return n.value, nil
+}
+
+func (n textNode) render(data any) (any, error) {
+	var buf bytes.Buffer
+	if err := n.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", n.tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+func (n valueNode) render(data any) (any, error) {
+	var buf bytes.Buffer
+	if err := n.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("mapping %s: %w", n.tmpl.Name(), err)
+	}
+	return json.RawMessage(buf.Bytes()), nil
+}
+
+// funcs 模板可用的函数
+func funcs(tables map[string]map[string]any) template.FuncMap {
+	return template.FuncMap{
+		// lookup 按值查码表，未命中时返回 nil，可配合 default 使用
+		"lookup": func(table string, value any) (any, error) {
+			t, ok := tables[table]
+			if !ok {
+				return nil, fmt.Errorf("unknown lookup table %q", table)
+			}
+			return t[fmt.Sprint(value)], nil
+		},
+		// default 值为 nil 或空字符串时使用 def
+		"default": func(def, value any) any {
+			if value == nil || value == "" {
+				return def
+			}
+			return value
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		"trim":  strings.TrimSpace,
+		"toJSON": func(value any) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
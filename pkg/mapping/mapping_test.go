@@ -0,0 +1,80 @@
+package mapping
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	body := map[string]any{
+		"userName": "{{ .userName }}",
+		"gender":   "{{ .gender }}",
+		"sex":      `{{ lookup "gender" .gender | default "unknown" }}`,
+		"title":    "{{ upper .userName }} ({{ .name }})",
+		"source":   "jos",
+		"enabled":  true,
+		"profile": map[string]any{
+			"emails": []any{"{{ .email }}", "static@example.com"},
+		},
+	}
+	tmpl, err := Compile(body, map[string]map[string]any{"gender": {"1": "male"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		data map[string]any
+		want string
+	}{
+		{
+			map[string]any{"userName": "alice", "name": "Alice", "gender": 1, "email": "alice@example.com"},
+			`{"enabled":true,"gender":1,"profile":{"emails":["alice@example.com","static@example.com"]},"sex":"male","source":"jos","title":"ALICE (Alice)","userName":"alice"}`,
+		},
+		{
+			map[string]any{"userName": "bob", "name": "", "gender": 2, "email": ""},
+			`{"enabled":true,"gender":2,"profile":{"emails":["","static@example.com"]},"sex":"unknown","source":"jos","title":"BOB ()","userName":"bob"}`,
+		},
+	} {
+		out, err := tmpl.Render(tc.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := json.Marshal(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("Render(%v) =\n%s\nwant\n%s", tc.data, got, tc.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tc := range []struct {
+		body map[string]any
+		err  string
+	}{
+		{map[string]any{"a": map[string]any{"b": "{{ .x "}}, "mapping a.b"},
+		{map[string]any{"list": []any{"ok", "{{ nosuchfunc }}"}}, "mapping list[1]"},
+	} {
+		if _, err := Compile(tc.body, nil); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("Compile(%v) error = %v, want one mentioning %s", tc.body, err, tc.err)
+		}
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	for _, body := range []map[string]any{
+		{"x": "{{ .missing }}"},
+		{"x": `{{ lookup "nosuchtable" .userName }}`},
+	} {
+		tmpl, err := Compile(body, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tmpl.Render(map[string]any{"userName": "alice"}); err == nil {
+			t.Errorf("Render() of %v succeeded", body)
+		}
+	}
+}
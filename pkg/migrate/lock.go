@@ -0,0 +1,67 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+)
+
+// 迁移锁的名称（MySQL）和键（PostgreSQL），同一数据库上的所有代理实例共用
+const (
+	lockName = "proxy_schema_migrations"
+	lockKey  = 7_261_530_941 // 任意固定值，与其他使用 advisory lock 的程序区分
+	// MySQL 等待锁的秒数
+	lockTimeout = 600
+)
+
+// Lock takes the database-wide migration lock so that proxies sharing a MySQL
+// or PostgreSQL state database do not run the same migration concurrently.
+// The lock is held on a dedicated connection until unlock is called. SQLite
+// is only opened by a single process and needs no lock.
+func (m *Migrator) Lock(ctx context.Context) (unlock func(), err error) {
+	dialect := m.db.Dialector.Name()
+	if dialect != "mysql" && dialect != "postgres" {
+		return func() {}, nil
+	}
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a connection for the migration lock: %w", err)
+	}
+
+	var release func(context.Context) error
+	if dialect == "mysql" {
+		var acquired sql.NullInt64
+		err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeout).Scan(&acquired)
+		if err == nil && acquired.Int64 != 1 {
+			err = fmt.Errorf("timed out after %ds", lockTimeout)
+		}
+		release = func(ctx context.Context) error {
+			_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+			return err
+		}
+	} else {
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey)
+		release = func(ctx context.Context) error {
+			_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", lockKey)
+			return err
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	return func() {
+		if err := release(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("Failed to release the migration lock: %v", err)
+			// 不放回连接池，关闭连接结束会话，锁随之释放
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
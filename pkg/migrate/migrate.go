@@ -0,0 +1,442 @@
+package migrate
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 一个版本的表结构变更，由 <版本>_<名称>.up.sql 和可选的 .down.sql 组成，
+// 或由 Go 代码实现
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string // 为空时不可回滚
+	// 以 Go 代码实现的迁移，如需要读取其他库的数据迁移；设置时忽略 Up 和 Down
+	UpFunc   Func
+	DownFunc Func   // 为空时不可回滚
+	Checksum string // Up 和 Down 的 sha256，已执行的迁移不允许再修改
+}
+
+// Func 在迁移事务 tx 中执行的 Go 代码迁移
+type Func func(ctx context.Context, tx *gorm.DB) error
+
+// code 是否为 Go 代码实现的迁移
+func (mg Migration) code() bool {
+	return mg.UpFunc != nil
+}
+
+// reversible 迁移是否可回滚
+func (mg Migration) reversible() bool {
+	if mg.code() {
+		return mg.DownFunc != nil
+	}
+	return mg.Down != ""
+}
+
+// run 在事务中执行迁移的 up 或 down
+func (mg Migration) run(ctx context.Context, tx *gorm.DB, up bool) error {
+	switch {
+	case mg.code() && up:
+		return mg.UpFunc(ctx, tx)
+	case mg.code():
+		return mg.DownFunc(ctx, tx)
+	case up:
+		return exec(tx, mg.Up)
+	default:
+		return exec(tx, mg.Down)
+	}
+}
+
+// checksum SQL 迁移为 up 和 down 文件内容的 sha256，Go 代码迁移只能按名称计算
+func (mg Migration) checksum() string {
+	h := sha256.New()
+	if mg.code() {
+		h.Write([]byte("go:" + mg.Name))
+	} else {
+		h.Write([]byte(mg.Up))
+		h.Write([]byte{0})
+		h.Write([]byte(mg.Down))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fileName 迁移文件名，如 0002_add_user_id.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_([0-9A-Za-z_]+)\.(up|down)\.sql$`)
+
+// Load reads the migrations in the root of fsys and merges them with the Go
+// code migrations, ordered by version. Every SQL version must have an up file
+// and no version may be both SQL and code; other files are ignored.
+func Load(fsys fs.FS, code ...Migration) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion)+len(code))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		m.Checksum = m.checksum()
+		migrations = append(migrations, *m)
+	}
+	for _, m := range code {
+		if m.Version == 0 || !m.code() {
+			return nil, fmt.Errorf("invalid code migration %d_%s", m.Version, m.Name)
+		}
+		if sql, ok := byVersion[m.Version]; ok {
+			return nil, fmt.Errorf("migration %d has both SQL %s and code %s", m.Version, sql.Name, m.Name)
+		}
+		m.Checksum = m.checksum()
+		migrations = append(migrations, m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version == migrations[i-1].Version {
+			return nil, fmt.Errorf("duplicate code migration version %d", migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// record schema_migrations 中已执行的迁移
+type record struct {
+	Version   uint64    `gorm:"column:version;primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"column:name;type:varchar(255);not null"`
+	Checksum  string    `gorm:"column:checksum;type:varchar(64);not null"`
+	AppliedAt time.Time `gorm:"column:applied_at;not null"`
+}
+
+func (record) TableName() string {
+	return "schema_migrations"
+}
+
+// Status 迁移的执行状态
+type Status struct {
+	Version   uint64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// 已执行的迁移文件被修改，或已执行的版本没有对应的迁移文件
+	Problem string
+}
+
+// Migrator 按版本顺序执行迁移，并记录到 schema_migrations
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// New returns a migrator of db for the migrations, which must be ordered by
+// version as returned by Load.
+func New(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Latest returns the version of the newest migration, or 0 when there is none.
+func (m *Migrator) Latest() uint64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// applied 已执行的迁移，按版本排序；只读，schema_migrations 不存在时视为没有
+func (m *Migrator) applied(ctx context.Context) ([]record, error) {
+	db := m.db.WithContext(ctx)
+	if !db.Migrator().HasTable(&record{}) {
+		return nil, nil
+	}
+	var records []record
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	return records, nil
+}
+
+// createTable 执行或记录迁移前创建 schema_migrations
+func (m *Migrator) createTable(ctx context.Context) error {
+	if err := m.db.WithContext(ctx).AutoMigrate(&record{}); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// find 按版本查找迁移
+func (m *Migrator) find(version uint64) (Migration, bool) {
+	i, ok := slices.BinarySearchFunc(m.migrations, version, func(mg Migration, v uint64) int { return cmp.Compare(mg.Version, v) })
+	if !ok {
+		return Migration{}, false
+	}
+	return m.migrations[i], true
+}
+
+// Status reports every migration, applied or not, together with applied
+// versions that have no migration file.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	records, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[uint64]record, len(records))
+	for _, r := range records {
+		byVersion[r.Version] = r
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mg := range m.migrations {
+		s := Status{Version: mg.Version, Name: mg.Name}
+		if r, ok := byVersion[mg.Version]; ok {
+			s.Applied, s.AppliedAt = true, r.AppliedAt
+			if r.Checksum != mg.Checksum {
+				s.Problem = fmt.Sprintf("checksum %s differs from applied %s", short(mg.Checksum), short(r.Checksum))
+			}
+			delete(byVersion, mg.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for _, r := range records {
+		if _, ok := byVersion[r.Version]; ok {
+			statuses = append(statuses, Status{Version: r.Version, Name: r.Name, Applied: true, AppliedAt: r.AppliedAt, Problem: "no migration file"})
+		}
+	}
+	slices.SortFunc(statuses, func(a, b Status) int { return cmp.Compare(a.Version, b.Version) })
+	return statuses, nil
+}
+
+// short 校验和的前 12 位，用于错误提示
+func short(checksum string) string {
+	if len(checksum) > 12 {
+		return checksum[:12]
+	}
+	return checksum
+}
+
+// Verify checks that the applied migrations match the migration files and
+// that no pending migration is older than an applied one.
+func (m *Migrator) Verify(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return verify(statuses)
+}
+
+// verify 检查已执行迁移的校验和，以及是否有比已执行版本更早的未执行迁移
+func verify(statuses []Status) error {
+	var errs []error
+	var newest uint64
+	for _, s := range statuses {
+		if s.Applied {
+			newest = s.Version
+		}
+	}
+	for _, s := range statuses {
+		if s.Problem != "" {
+			errs = append(errs, fmt.Errorf("migration %d_%s: %s", s.Version, s.Name, s.Problem))
+		}
+		if !s.Applied && s.Version < newest {
+			errs = append(errs, fmt.Errorf("migration %d_%s is pending but %d is already applied", s.Version, s.Name, newest))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Pending returns the migrations not applied yet, after verifying the applied ones.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(statuses); err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			mg, _ := m.find(s.Version)
+			pending = append(pending, mg)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations up to and including version target, or
+// all of them when target is 0. Each migration runs in its own transaction
+// together with its schema_migrations record; MySQL commits DDL implicitly,
+// so there a failed migration may be partly applied. Callers sharing the
+// database with other processes must hold Lock.
+func (m *Migrator) Up(ctx context.Context, target uint64) ([]Migration, error) {
+	pending, err := m.Pending(ctx)
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+	if err := m.createTable(ctx); err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, mg := range pending {
+		if target != 0 && mg.Version > target {
+			break
+		}
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := mg.run(ctx, tx, true); err != nil {
+				return err
+			}
+			return tx.Create(&record{Version: mg.Version, Name: mg.Name, Checksum: mg.Checksum, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %w", mg.Version, mg.Name, err)
+		}
+		log.Printf("Applied migration %d_%s", mg.Version, mg.Name)
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Down reverts the newest steps applied migrations, newest first. It stops at
+// the first migration that cannot be reverted. Callers sharing the database
+// with other processes must hold Lock.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(statuses); err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+		if !statuses[i].Applied {
+			continue
+		}
+		mg, _ := m.find(statuses[i].Version)
+		if !mg.reversible() {
+			return done, fmt.Errorf("migration %d_%s cannot be reverted", mg.Version, mg.Name)
+		}
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := mg.run(ctx, tx, false); err != nil {
+				return err
+			}
+			return tx.Delete(&record{Version: mg.Version}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("reverting migration %d_%s failed: %w", mg.Version, mg.Name, err)
+		}
+		log.Printf("Reverted migration %d_%s", mg.Version, mg.Name)
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// Initialized reports whether any migration has been recorded.
+func (m *Migrator) Initialized(ctx context.Context) (bool, error) {
+	records, err := m.applied(ctx)
+	if err != nil {
+		return false, err
+	}
+	return len(records) > 0, nil
+}
+
+// Baseline records the migrations up to and including version as applied
+// without running them, for a database whose schema was created otherwise.
+// It is only allowed before any migration has been recorded.
+func (m *Migrator) Baseline(ctx context.Context, version uint64) error {
+	initialized, err := m.Initialized(ctx)
+	if err != nil {
+		return err
+	}
+	if initialized {
+		return fmt.Errorf("cannot baseline: migrations have already been recorded")
+	}
+	if err := m.createTable(ctx); err != nil {
+		return err
+	}
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, mg := range m.migrations {
+			if mg.Version > version {
+				break
+			}
+			if err := tx.Create(&record{Version: mg.Version, Name: mg.Name, Checksum: mg.Checksum, AppliedAt: time.Now()}).Error; err != nil {
+				return fmt.Errorf("failed to record migration %d_%s: %w", mg.Version, mg.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// exec 逐条执行迁移中的语句
+func exec(tx *gorm.DB, script string) error {
+	for _, stmt := range statements(script) {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statements 按行尾的分号拆分语句，忽略 -- 注释行和空行
+func statements(script string) []string {
+	var stmts []string
+	var buf strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(script))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "--") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		if strings.HasSuffix(line, ";") {
+			stmts = append(stmts, strings.TrimSpace(buf.String()))
+			buf.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(buf.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
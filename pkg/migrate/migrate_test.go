@@ -0,0 +1,195 @@
+package migrate
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "state.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testFiles() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_init.up.sql":       {Data: []byte("CREATE TABLE a (id integer);\n")},
+		"0001_init.down.sql":     {Data: []byte("DROP TABLE a;\n")},
+		"0002_add_b.up.sql":      {Data: []byte("-- b\nCREATE TABLE b (\n  id integer\n);\nCREATE INDEX idx_b ON b(id);\n")},
+		"0002_add_b.down.sql":    {Data: []byte("DROP TABLE b;\n")},
+		"README.md":              {Data: []byte("ignored")},
+		"0003_no_down.up.sql":    {Data: []byte("CREATE TABLE c (id integer)")},
+		"nested/0009_x.up.sql":   {Data: []byte("ignored")},
+		"0004_not_a_migration.x": {Data: []byte("ignored")},
+	}
+}
+
+func TestStatements(t *testing.T) {
+	script := `-- comment
+CREATE TABLE t (
+  id integer, -- trailing comments stay
+  name varchar(20)
+);
+
+  -- indented comment
+INSERT INTO t VALUES (1, 'a;b');
+UPDATE t SET name = 'c'`
+	want := []string{
+		"CREATE TABLE t (\nid integer, -- trailing comments stay\nname varchar(20)\n);",
+		"INSERT INTO t VALUES (1, 'a;b');",
+		"UPDATE t SET name = 'c'",
+	}
+	if got := statements(script); !slices.Equal(got, want) {
+		t.Errorf("statements() = %q, want %q", got, want)
+	}
+	if got := statements("-- only comments\n\n"); len(got) != 0 {
+		t.Errorf("statements() of comments = %q, want none", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	up := func(context.Context, *gorm.DB) error { return nil }
+	migrations, err := Load(testFiles(), Migration{Version: 5, Name: "code", UpFunc: up})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []uint64
+	for _, mg := range migrations {
+		versions = append(versions, mg.Version)
+		if mg.Checksum == "" {
+			t.Errorf("migration %d has no checksum", mg.Version)
+		}
+	}
+	if want := []uint64{1, 2, 3, 5}; !slices.Equal(versions, want) {
+		t.Fatalf("versions = %v, want %v", versions, want)
+	}
+	if migrations[2].reversible() || !migrations[0].reversible() || migrations[3].reversible() {
+		t.Errorf("unexpected reversibility")
+	}
+
+	// 修改 down 文件也会改变校验和
+	files := testFiles()
+	files["0001_init.down.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE a; -- changed\n")}
+	changed, err := Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed[0].Checksum == migrations[0].Checksum {
+		t.Errorf("checksum does not cover the down file")
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"no up":     {"0001_a.down.sql": {Data: []byte("x")}},
+		"two names": {"0001_a.up.sql": {Data: []byte("x")}, "0001_b.down.sql": {Data: []byte("x")}},
+		"version 0": {"0000_a.up.sql": {Data: []byte("x")}},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("Load(%s) succeeded, want error", name)
+		}
+	}
+	if _, err := Load(testFiles(), Migration{Version: 2, Name: "dup", UpFunc: up}); err == nil {
+		t.Errorf("Load with a code migration on a SQL version succeeded, want error")
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	var ran []string
+	migrations, err := Load(testFiles(), Migration{
+		Version:  4,
+		Name:     "code",
+		UpFunc:   func(ctx context.Context, tx *gorm.DB) error { ran = append(ran, "up"); return nil },
+		DownFunc: func(ctx context.Context, tx *gorm.DB) error { ran = append(ran, "down"); return nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, migrations)
+
+	// 查询状态不创建 schema_migrations
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 4 || statuses[0].Applied {
+		t.Fatalf("status of new database = %+v", statuses)
+	}
+	if err := m.Verify(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if db.Migrator().HasTable("schema_migrations") {
+		t.Fatalf("Status created schema_migrations")
+	}
+
+	done, err := m.Up(ctx, 2)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("Up(2) = %d migrations, %v", len(done), err)
+	}
+	if !db.Migrator().HasTable("b") || db.Migrator().HasTable("c") {
+		t.Fatalf("Up(2) applied the wrong migrations")
+	}
+	if done, err = m.Up(ctx, 0); err != nil || len(done) != 2 || !slices.Equal(ran, []string{"up"}) {
+		t.Fatalf("Up(0) = %d migrations, %v, ran %v", len(done), err, ran)
+	}
+	if pending, err := m.Pending(ctx); err != nil || len(pending) != 0 {
+		t.Fatalf("Pending() = %v, %v", pending, err)
+	}
+
+	// 0004 可回滚，0003 没有 down 文件
+	done, err = m.Down(ctx, 3)
+	if err == nil || !strings.Contains(err.Error(), "3_no_down") {
+		t.Fatalf("Down(3) error = %v, want 0003 not reversible", err)
+	}
+	if len(done) != 1 || !slices.Equal(ran, []string{"up", "down"}) {
+		t.Fatalf("Down(3) reverted %d migrations, ran %v", len(done), ran)
+	}
+
+	// 已执行的迁移被修改
+	files := testFiles()
+	files["0002_add_b.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE b2 (id integer);")}
+	changed, err := Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New(db, changed).Verify(ctx); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Verify() of a changed migration = %v, want checksum error", err)
+	}
+	if _, err := New(db, changed).Up(ctx, 0); err == nil {
+		t.Errorf("Up() with a changed migration succeeded")
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	migrations, err := Load(testFiles())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(db, migrations)
+	if err := m.Baseline(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Baseline(ctx, 1); err == nil {
+		t.Errorf("second Baseline succeeded")
+	}
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Version != 2 {
+		t.Errorf("pending after baseline = %+v", pending)
+	}
+}
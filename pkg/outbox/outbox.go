@@ -0,0 +1,297 @@
+package outbox
+
+import (
+	"center/model"
+	"center/pkg/config"
+	"center/pkg/db"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Handler 执行单个同步任务，返回错误时任务按退避策略重试
+// 可将下游返回码和信息写入 job.LastCode、job.LastMessage
+type Handler func(ctx context.Context, job *model.SyncJob) error
+
+// DeferError 由 Handler 返回，任务推迟到 Until 再执行，不计入重试次数
+type DeferError struct {
+	Until time.Time
+	Err   error
+}
+
+func (e *DeferError) Error() string { return e.Err.Error() }
+func (e *DeferError) Unwrap() error { return e.Err }
+
+// ResultFunc 任务每次执行结果保存后调用，ctx 不会被取消
+type ResultFunc func(ctx context.Context, job *model.SyncJob)
+
+// Pool 从 outbox 表领取到期任务并交给 worker 并发执行
+type Pool struct {
+	cfg      config.OutboxConfig
+	handler  Handler
+	onResult ResultFunc
+	wake     chan struct{}
+	wg       sync.WaitGroup
+
+	// 按幂等键串行执行，避免同一 (用户, 应用) 的任务并发调用下游
+	keysMu sync.Mutex
+	keys   map[string]*keyLock
+}
+
+// keyLock 幂等键的互斥锁，refs 为持有或等待该锁的任务数
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// NewPool creates a worker pool that runs handler for every due job and calls
+// onResult, if not nil, after each attempt has been recorded.
+func NewPool(cfg config.OutboxConfig, handler Handler, onResult ResultFunc) *Pool {
+	return &Pool{
+		cfg:      cfg,
+		handler:  handler,
+		onResult: onResult,
+		wake:     make(chan struct{}, 1),
+		keys:     make(map[string]*keyLock),
+	}
+}
+
+// Start recovers jobs left running by a previous process and starts the
+// dispatcher and workers. They stop when ctx is cancelled; Wait blocks until then.
+func (p *Pool) Start(ctx context.Context) error {
+	if err := p.requeueInterrupted(ctx); err != nil {
+		return err
+	}
+
+	jobs := make(chan model.SyncJob)
+	for i := 0; i < p.cfg.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range jobs {
+				p.run(ctx, &job)
+			}
+		}()
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer close(jobs)
+		p.dispatch(ctx, jobs)
+	}()
+	return nil
+}
+
+// Wait blocks until the dispatcher and all workers have stopped.
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// Dispatch persists jobs and runs them right away, at most inlineConcurrency at
+// a time, returning them in input order with their outcome. Jobs that fail, or
+// that have not started when ctx is cancelled, stay in the outbox for the
+// background workers.
+func (p *Pool) Dispatch(ctx context.Context, jobs []model.SyncJob) ([]model.SyncJob, error) {
+	// 以执行中状态写入，避免后台 worker 同时领取
+	if err := p.persist(ctx, jobs, model.SyncJobRunning); err != nil {
+		return nil, err
+	}
+
+	sem := make(chan struct{}, p.cfg.InlineConcurrency)
+	var wg sync.WaitGroup
+	for i := range jobs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			p.release(ctx, jobs[i:])
+			break
+		}
+		wg.Add(1)
+		go func(job *model.SyncJob) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			p.run(ctx, job)
+		}(&jobs[i])
+	}
+	wg.Wait()
+	return jobs, nil
+}
+
+// persist 初始化任务字段并写入 outbox
+func (p *Pool) persist(ctx context.Context, jobs []model.SyncJob, status string) error {
+	now := time.Now()
+	for i := range jobs {
+		jobs[i].Status = status
+		jobs[i].Attempts = 0
+		if jobs[i].MaxAttempts == 0 {
+			jobs[i].MaxAttempts = p.cfg.MaxAttempts
+		}
+		if jobs[i].NextRunAt.IsZero() {
+			jobs[i].NextRunAt = now
+		}
+	}
+	return db.DB.CreateSyncJobs(ctx, jobs)
+}
+
+// release 将未执行的任务交还给后台 worker，ctx 已取消时仍需写入
+func (p *Pool) release(ctx context.Context, jobs []model.SyncJob) {
+	ctx = context.WithoutCancel(ctx)
+	for i := range jobs {
+		jobs[i].Status = model.SyncJobPending
+		if err := db.DB.SaveSyncJobResult(ctx, &jobs[i]); err != nil {
+			log.Printf("Failed to release sync job %d: %v", jobs[i].ID, err)
+		}
+	}
+	p.notify()
+}
+
+func (p *Pool) notify() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 定时或被唤醒时领取到期任务
+func (p *Pool) dispatch(ctx context.Context, jobs chan<- model.SyncJob) {
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		// 接管其他实例退出时未完成的任务
+		if p.cfg.RunningTimeout > 0 {
+			if err := p.requeueInterrupted(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to requeue interrupted sync jobs: %v", err)
+			}
+		}
+		due, err := db.DB.ClaimDueSyncJobs(ctx, time.Now(), p.cfg.BatchSize)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to claim sync jobs: %v", err)
+		}
+		for _, job := range due {
+			select {
+			case jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+		// 一批领满时可能还有到期任务，立即继续
+		if len(due) == p.cfg.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+	}
+}
+
+// requeueInterrupted 将中断的执行中任务重新置为待执行：未配置 runningTimeout 时为全部执行中的任务
+func (p *Pool) requeueInterrupted(ctx context.Context) error {
+	before := time.Now()
+	if p.cfg.RunningTimeout > 0 {
+		before = before.Add(-p.cfg.RunningTimeout)
+	}
+	n, err := db.DB.ResetRunningSyncJobs(ctx, before)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("Requeued %d interrupted sync jobs", n)
+	}
+	return nil
+}
+
+// lock 获取幂等键的锁，返回解锁函数
+func (p *Pool) lock(key string) func() {
+	if key == "" {
+		return func() {}
+	}
+	p.keysMu.Lock()
+	l, ok := p.keys[key]
+	if !ok {
+		l = &keyLock{}
+		p.keys[key] = l
+	}
+	l.refs++
+	p.keysMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		p.keysMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(p.keys, key)
+		}
+		p.keysMu.Unlock()
+	}
+}
+
+// run 执行任务并记录结果，失败时按指数退避重新排期或进入死信
+func (p *Pool) run(ctx context.Context, job *model.SyncJob) {
+	unlock := p.lock(job.IdempotencyKey)
+	defer unlock()
+
+	job.Attempts++
+	job.LastCode, job.LastMessage = 0, ""
+	start := time.Now()
+	err := p.handler(ctx, job)
+	job.LatencyMs = time.Since(start).Milliseconds()
+	var deferErr *DeferError
+	switch {
+	case err == nil:
+		job.Status = model.SyncJobDone
+		job.LastError = ""
+	case errors.As(err, &deferErr):
+		job.Attempts--
+		job.Status = model.SyncJobPending
+		job.NextRunAt = deferErr.Until
+		job.LastError = err.Error()
+		log.Printf("Sync job %d (%s app %d, %s) deferred until %s: %v",
+			job.ID, job.UserName, job.AppID, job.Operation, job.NextRunAt.Format(time.RFC3339), err)
+	case ctx.Err() != nil:
+		// 被取消（客户端断开或进程退出）不计入重试次数，交给后台 worker 立即重试
+		job.Attempts--
+		job.Status = model.SyncJobPending
+		job.NextRunAt = time.Now()
+		job.LastError = err.Error()
+	default:
+		job.LastError = err.Error()
+		if job.Attempts >= job.MaxAttempts {
+			job.Status = model.SyncJobDead
+			log.Printf("Sync job %d (%s app %d, %s) dead after %d attempts: %v",
+				job.ID, job.UserName, job.AppID, job.Operation, job.Attempts, err)
+		} else {
+			job.Status = model.SyncJobPending
+			job.NextRunAt = time.Now().Add(p.backoff(job.Attempts))
+			log.Printf("Sync job %d (%s app %d, %s) attempt %d failed, retry at %s: %v",
+				job.ID, job.UserName, job.AppID, job.Operation, job.Attempts, job.NextRunAt.Format(time.RFC3339), err)
+		}
+	}
+	// 请求取消或进程退出时结果仍需写入
+	ctx = context.WithoutCancel(ctx)
+	if err := db.DB.SaveSyncJobResult(ctx, job); err != nil {
+		log.Printf("Failed to save sync job %d result: %v", job.ID, err)
+	}
+	if p.onResult != nil {
+		p.onResult(ctx, job)
+	}
+}
+
+// backoff 第 n 次失败后的等待时间：baseBackoff * 2^(n-1)，不超过 maxBackoff
+func (p *Pool) backoff(attempts int) time.Duration {
+	d := p.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= p.cfg.MaxBackoff {
+			return p.cfg.MaxBackoff
+		}
+	}
+	return d
+}
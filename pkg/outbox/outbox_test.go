@@ -0,0 +1,233 @@
+package outbox
+
+import (
+	"center/model"
+	"center/pkg/config"
+	"center/pkg/db"
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupDB 使用迁移后的 sqlite 状态库
+func setupDB(t *testing.T) {
+	t.Helper()
+	state, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "state.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.NewStateMigrator(state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MigrateState(context.Background(), state, m, 0); err != nil {
+		t.Fatal(err)
+	}
+	orig := db.DB
+	db.DB = db.Database{StateDb: state}
+	t.Cleanup(func() { db.DB = orig })
+}
+
+func testConfig() config.OutboxConfig {
+	return config.OutboxConfig{
+		Workers: 2, InlineConcurrency: 4, PollInterval: 10 * time.Millisecond, BatchSize: 10,
+		MaxAttempts: 2, BaseBackoff: time.Minute, MaxBackoff: time.Hour,
+	}
+}
+
+func newJob(userName string, appID uint64) model.SyncJob {
+	user := model.UserKey{UserName: userName}
+	return model.SyncJob{UserName: userName, AppID: appID, Operation: model.SyncOpCreate, IdempotencyKey: model.SyncJobKey(user, appID)}
+}
+
+func loadJobs(t *testing.T) []model.SyncJob {
+	t.Helper()
+	var jobs []model.SyncJob
+	if err := db.DB.StateDb.Order("id").Find(&jobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+func TestDispatchSerializesKey(t *testing.T) {
+	setupDB(t)
+	var mu sync.Mutex
+	active, peak := map[string]int{}, map[string]int{}
+	p := NewPool(testConfig(), func(ctx context.Context, job *model.SyncJob) error {
+		mu.Lock()
+		active[job.IdempotencyKey]++
+		peak[job.IdempotencyKey] = max(peak[job.IdempotencyKey], active[job.IdempotencyKey])
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		active[job.IdempotencyKey]--
+		mu.Unlock()
+		return nil
+	}, nil)
+
+	jobs, err := p.Dispatch(context.Background(), []model.SyncJob{newJob("alice", 10), newJob("alice", 10), newJob("alice", 10), newJob("bob", 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		if job.Status != model.SyncJobDone {
+			t.Errorf("job %d status = %s", job.ID, job.Status)
+		}
+	}
+	for key, n := range peak {
+		if n != 1 {
+			t.Errorf("%d jobs of %s ran at once", n, key)
+		}
+	}
+	if len(p.keys) != 0 {
+		t.Errorf("key locks left after dispatch: %v", p.keys)
+	}
+}
+
+func TestDispatchSupersedesPending(t *testing.T) {
+	setupDB(t)
+	ctx := context.Background()
+	pending := []model.SyncJob{newJob("alice", 10), newJob("alice", 11)}
+	pending[0].Operation = model.SyncOpDelete
+	for i := range pending {
+		pending[i].Status, pending[i].MaxAttempts, pending[i].NextRunAt = model.SyncJobPending, 2, time.Now().Add(time.Hour)
+	}
+	if err := db.DB.CreateSyncJobs(ctx, pending); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPool(testConfig(), func(ctx context.Context, job *model.SyncJob) error { return nil }, nil)
+	if _, err := p.Dispatch(ctx, []model.SyncJob{newJob("alice", 10)}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{model.SyncJobSuperseded, model.SyncJobPending, model.SyncJobDone}
+	for i, job := range loadJobs(t) {
+		if job.Status != want[i] {
+			t.Errorf("job %d (%s app %d) status = %s, want %s", job.ID, job.Operation, job.AppID, job.Status, want[i])
+		}
+	}
+}
+
+func TestRunOutcomes(t *testing.T) {
+	setupDB(t)
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	failure := errors.New("bad request")
+	for _, tc := range []struct {
+		name     string
+		err      error
+		cancel   bool
+		attempts int // 执行前已执行次数
+		status   string
+		counted  bool
+	}{
+		{"success", nil, false, 0, model.SyncJobDone, true},
+		{"deferred", &DeferError{Until: until, Err: failure}, false, 1, model.SyncJobPending, false},
+		{"retry", failure, false, 0, model.SyncJobPending, true},
+		{"dead", failure, false, 1, model.SyncJobDead, true},
+		{"cancelled", context.Canceled, true, 1, model.SyncJobPending, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var results int
+			p := NewPool(testConfig(), func(ctx context.Context, job *model.SyncJob) error { return tc.err },
+				func(ctx context.Context, job *model.SyncJob) {
+					if ctx.Err() != nil {
+						t.Errorf("result recorded with a cancelled context")
+					}
+					results++
+				})
+			job := newJob("alice", 10)
+			if err := p.persist(context.Background(), []model.SyncJob{job}, model.SyncJobRunning); err != nil {
+				t.Fatal(err)
+			}
+			job = loadJobs(t)[len(loadJobs(t))-1]
+			job.Attempts = tc.attempts
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tc.cancel {
+				cancel()
+			}
+			defer cancel()
+			start := time.Now()
+			p.run(ctx, &job)
+
+			wantAttempts := tc.attempts
+			if tc.counted {
+				wantAttempts++
+			}
+			if job.Status != tc.status || job.Attempts != wantAttempts || results != 1 {
+				t.Errorf("job = %s after %d attempts (%d results), want %s after %d", job.Status, job.Attempts, results, tc.status, wantAttempts)
+			}
+			switch tc.name {
+			case "deferred":
+				if !job.NextRunAt.Equal(until) {
+					t.Errorf("deferred until %v, want %v", job.NextRunAt, until)
+				}
+			case "retry":
+				if job.NextRunAt.Before(start.Add(time.Minute)) {
+					t.Errorf("retry at %v, want after the base backoff", job.NextRunAt)
+				}
+			case "cancelled":
+				if job.NextRunAt.After(time.Now()) {
+					t.Errorf("cancelled job delayed until %v", job.NextRunAt)
+				}
+			}
+			var saved model.SyncJob
+			if err := db.DB.StateDb.First(&saved, job.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved.Status != job.Status || saved.Attempts != job.Attempts {
+				t.Errorf("saved job = %s after %d attempts, want %s after %d", saved.Status, saved.Attempts, job.Status, job.Attempts)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := NewPool(config.OutboxConfig{BaseBackoff: time.Second, MaxBackoff: 5 * time.Second}, nil, nil)
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := p.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
+
+func TestStartRequeuesAndStops(t *testing.T) {
+	setupDB(t)
+	// 上次进程退出时仍在执行的任务
+	interrupted := newJob("alice", 10)
+	interrupted.Status, interrupted.MaxAttempts, interrupted.NextRunAt = model.SyncJobRunning, 2, time.Now()
+	if err := db.DB.CreateSyncJobs(context.Background(), []model.SyncJob{interrupted}); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := make(chan struct{})
+	p := NewPool(testConfig(), func(ctx context.Context, job *model.SyncJob) error {
+		close(ran)
+		// 执行到一半时进程退出
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := p.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("interrupted job was not rerun")
+	}
+	cancel()
+	p.Wait()
+
+	jobs := loadJobs(t)
+	if jobs[0].Status != model.SyncJobPending || jobs[0].Attempts != 0 {
+		t.Errorf("job interrupted by shutdown = %s after %d attempts, want pending and not counted", jobs[0].Status, jobs[0].Attempts)
+	}
+}
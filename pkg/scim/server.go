@@ -0,0 +1,514 @@
+package scim
+
+import (
+	"center/model"
+	"center/pkg/config"
+	"center/pkg/db"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SCIM 2.0 schema (RFC 7643/7644)
+const (
+	userSchema   = "urn:ietf:params:scim:schemas:core:2.0:User"
+	groupSchema  = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	listSchema   = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	errorSchema  = "urn:ietf:params:scim:api:messages:2.0:Error"
+	contentType  = "application/scim+json"
+	PathPrefix   = "/scim/v2" // 接口路径前缀
+	defaultCount = 100
+)
+
+// 仅支持 attr eq "value" 形式的过滤条件
+var eqFilter = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location"`
+	Version      string `json:"version,omitempty"`
+}
+
+type Name struct {
+	Formatted string `json:"formatted,omitempty"`
+}
+
+type MultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// User SCIM 用户资源，id 为用户中心用户ID，externalId 为该应用中的账号ID
+type User struct {
+	Schemas      []string     `json:"schemas"`
+	ID           string       `json:"id"`
+	ExternalID   string       `json:"externalId,omitempty"`
+	UserName     string       `json:"userName"`
+	Name         *Name        `json:"name,omitempty"`
+	DisplayName  string       `json:"displayName,omitempty"`
+	NickName     string       `json:"nickName,omitempty"`
+	Emails       []MultiValue `json:"emails,omitempty"`
+	PhoneNumbers []MultiValue `json:"phoneNumbers,omitempty"`
+	Active       bool         `json:"active"`
+	Meta         Meta         `json:"meta"`
+}
+
+type Member struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+// Group 每个应用对应一个组，成员为已授权该应用的用户
+type Group struct {
+	Schemas     []string `json:"schemas"`
+	ID          string   `json:"id"`
+	DisplayName string   `json:"displayName"`
+	Members     []Member `json:"members,omitempty"` // excludedAttributes=members 时不返回
+	Meta        Meta     `json:"meta"`
+}
+
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int64    `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    any      `json:"Resources"`
+}
+
+type Error struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+type server struct {
+	cfg config.SCIMServerConfig
+}
+
+// Handler returns the read-only SCIM 2.0 API serving, per app, the users granted
+// to it (/scim/v2/{appId}/Users) and one group of those users (/scim/v2/{appId}/Groups).
+func Handler(cfg config.SCIMServerConfig) http.Handler {
+	s := &server{cfg: cfg}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PathPrefix+"/{appId}/Users", s.listUsers)
+	mux.HandleFunc("GET "+PathPrefix+"/{appId}/Users/{id}", s.getUser)
+	mux.HandleFunc("GET "+PathPrefix+"/{appId}/Groups", s.listGroups)
+	mux.HandleFunc("GET "+PathPrefix+"/{appId}/Groups/{id}", s.getGroup)
+	mux.HandleFunc(PathPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "", "resource not found")
+	})
+	return s.authenticate(mux)
+}
+
+// authenticate 校验 Bearer Token
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.BearerToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="scim"`)
+			writeError(w, http.StatusUnauthorized, "", "authorization required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *server) listUsers(w http.ResponseWriter, r *http.Request) {
+	appID, ok := s.appID(w, r)
+	if !ok {
+		return
+	}
+	q := db.AppUserQuery{AppID: appID}
+	userName, filtered, ok := filterValue(w, r, "userName")
+	if !ok {
+		return
+	}
+	if filtered {
+		q.UserName = userName
+	}
+	startIndex, count, ok := s.pagination(w, r)
+	if !ok {
+		return
+	}
+	q.Offset, q.Limit = startIndex-1, count
+
+	users, total, err := db.DB.ListAppUsers(r.Context(), q)
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	resources, err := s.toUsers(r, appID, users)
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	writeJSON(w, r, ListResponse{
+		Schemas:      []string{listSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	}, "")
+}
+
+func (s *server) getUser(w http.ResponseWriter, r *http.Request) {
+	appID, ok := s.appID(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	q := db.AppUserQuery{AppID: appID}
+	q.UserID, q.Limit = userID, 1
+	users, _, err := db.DB.ListAppUsers(r.Context(), q)
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	if len(users) == 0 {
+		writeError(w, http.StatusNotFound, "", "user not found")
+		return
+	}
+	resources, err := s.toUsers(r, appID, users)
+	if err != nil {
+		s.internalError(w, err)
+		return
+	}
+	writeJSON(w, r, resources[0], resources[0].Meta.Version)
+}
+
+func (s *server) listGroups(w http.ResponseWriter, r *http.Request) {
+	appID, ok := s.appID(w, r)
+	if !ok {
+		return
+	}
+	displayName, filtered, ok := filterValue(w, r, "displayName")
+	if !ok {
+		return
+	}
+	group, ok := s.group(w, r, appID)
+	if !ok {
+		return
+	}
+	groups := []Group{group}
+	if filtered && group.DisplayName != displayName {
+		groups = nil
+	}
+	startIndex, count, ok := s.pagination(w, r)
+	if !ok {
+		return
+	}
+	total := len(groups)
+	if startIndex > 1 || count == 0 {
+		groups = nil
+	}
+	writeJSON(w, r, ListResponse{
+		Schemas:      []string{listSchema},
+		TotalResults: int64(total),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(groups),
+		Resources:    append([]Group{}, groups...),
+	}, "")
+}
+
+func (s *server) getGroup(w http.ResponseWriter, r *http.Request) {
+	appID, ok := s.appID(w, r)
+	if !ok {
+		return
+	}
+	if r.PathValue("id") != strconv.FormatUint(appID, 10) {
+		writeError(w, http.StatusNotFound, "", "group not found")
+		return
+	}
+	group, ok := s.group(w, r, appID)
+	if !ok {
+		return
+	}
+	writeJSON(w, r, group, group.Meta.Version)
+}
+
+// group 构建应用对应的组
+func (s *server) group(w http.ResponseWriter, r *http.Request, appID uint64) (Group, bool) {
+	app, err := db.DB.GetJosAppByAppID(r.Context(), appID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, http.StatusNotFound, "", "app not found")
+		} else {
+			s.internalError(w, err)
+		}
+		return Group{}, false
+	}
+	// 成员较多时调用方以 excludedAttributes=members 查询组，成员由 /Users 分页获取
+	var users []model.XjrUser
+	if !excluded(r, "members") {
+		// 一次查询取总数和不超过上限的成员，总数超出上限时成员不完整
+		var total int64
+		users, total, err = db.DB.ListAppUsers(r.Context(), db.AppUserQuery{AppID: appID, Limit: s.cfg.MaxGroupMembers})
+		if err != nil {
+			s.internalError(w, err)
+			return Group{}, false
+		}
+		if total > int64(s.cfg.MaxGroupMembers) {
+			writeError(w, http.StatusBadRequest, "tooMany", fmt.Sprintf(
+				"group has %d members, more than %d; request it with excludedAttributes=members and list the members from /Users", total, s.cfg.MaxGroupMembers))
+			return Group{}, false
+		}
+	}
+
+	base := baseURL(r, appID)
+	group := Group{
+		Schemas:     []string{groupSchema},
+		ID:          strconv.FormatUint(appID, 10),
+		DisplayName: app.AppName,
+		Members:     make([]Member, 0, len(users)),
+		Meta: Meta{
+			ResourceType: "Group",
+			Created:      formatTime(app.CreateDate),
+			LastModified: formatTime(app.ModifyDate),
+			Location:     base + "/Groups/" + strconv.FormatUint(appID, 10),
+		},
+	}
+	for _, user := range users {
+		id := strconv.FormatInt(user.ID, 10)
+		group.Members = append(group.Members, Member{Value: id, Display: user.UserName, Ref: base + "/Users/" + id})
+	}
+	group.Meta.Version = version(group)
+	return group, true
+}
+
+// toUsers 转换为 SCIM 用户，externalId 取该应用中的账号ID
+func (s *server) toUsers(r *http.Request, appID uint64, users []model.XjrUser) ([]User, error) {
+	keys := make([]model.UserKey, 0, len(users))
+	for _, user := range users {
+		keys = append(keys, user.Key())
+	}
+	// 按用户ID记录账号ID，未记录用户ID的旧映射按账号记录
+	byID := make(map[uint64]string)
+	byName := make(map[string]string)
+	if len(keys) > 0 {
+		mappings, err := db.DB.GetProxyUserAppsByApp(r.Context(), appID, keys)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range mappings {
+			ref := m.AppUserRef
+			if ref == "" && m.AppUserID != 0 {
+				ref = strconv.FormatUint(m.AppUserID, 10)
+			}
+			if ref == "" {
+				continue
+			}
+			if m.UserID != 0 {
+				byID[m.UserID] = ref
+			} else {
+				byName[m.UserName] = ref
+			}
+		}
+	}
+
+	base := baseURL(r, appID)
+	resources := make([]User, 0, len(users))
+	for _, user := range users {
+		id := strconv.FormatInt(user.ID, 10)
+		externalID, ok := byID[uint64(user.ID)]
+		if !ok {
+			externalID = byName[user.UserName]
+		}
+		res := User{
+			Schemas:     []string{userSchema},
+			ID:          id,
+			ExternalID:  externalID,
+			UserName:    user.UserName,
+			DisplayName: user.Name,
+			NickName:    user.NickName,
+			Active:      user.EnabledMark == 1,
+			Meta: Meta{
+				ResourceType: "User",
+				Created:      formatTime(user.CreateDate),
+				LastModified: formatTime(user.ModifyDate),
+				Location:     base + "/Users/" + id,
+			},
+		}
+		if user.Name != "" {
+			res.Name = &Name{Formatted: user.Name}
+		}
+		if user.Email != "" {
+			res.Emails = []MultiValue{{Value: user.Email, Type: "work", Primary: true}}
+		}
+		if user.Mobile != "" {
+			res.PhoneNumbers = []MultiValue{{Value: user.Mobile, Type: "mobile", Primary: true}}
+		}
+		res.Meta.Version = version(res)
+		resources = append(resources, res)
+	}
+	return resources, nil
+}
+
+// excluded 请求是否以 excludedAttributes 排除了属性
+func excluded(r *http.Request, attr string) bool {
+	for _, name := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(name), attr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *server) appID(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	appID, err := strconv.ParseUint(r.PathValue("appId"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "", "app not found")
+		return 0, false
+	}
+	return appID, true
+}
+
+// pagination 解析 startIndex（从 1 开始）和 count，count 不超过 maxResults
+func (s *server) pagination(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	startIndex, count := 1, min(defaultCount, s.cfg.MaxResults)
+	query := r.URL.Query()
+	if v := query.Get("startIndex"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalidValue", "startIndex must be an integer")
+			return 0, 0, false
+		}
+		startIndex = max(n, 1)
+	}
+	if v := query.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalidValue", "count must be an integer")
+			return 0, 0, false
+		}
+		count = min(max(n, 0), s.cfg.MaxResults)
+	}
+	return startIndex, count, true
+}
+
+func (s *server) internalError(w http.ResponseWriter, err error) {
+	log.Printf("SCIM request failed: %v", err)
+	writeError(w, http.StatusInternalServerError, "", "internal error")
+}
+
+// filterValue 解析 filter 参数，只支持 attr eq "value"；参数为空、重复或是其他过滤条件时返回 400 invalidFilter
+func filterValue(w http.ResponseWriter, r *http.Request, attr string) (value string, filtered, ok bool) {
+	filters, filtered := r.URL.Query()["filter"]
+	if !filtered {
+		return "", false, true
+	}
+	if len(filters) == 1 {
+		if name, value, err := parseFilter(filters[0]); err == nil && strings.EqualFold(name, attr) {
+			return value, true, true
+		}
+	}
+	writeError(w, http.StatusBadRequest, "invalidFilter", fmt.Sprintf("only %s eq \"value\" filters are supported", attr))
+	return "", false, false
+}
+
+// parseFilter 解析 attr eq "value"
+func parseFilter(filter string) (string, string, error) {
+	m := eqFilter.FindStringSubmatch(filter)
+	if m == nil {
+		return "", "", fmt.Errorf("unsupported filter %q", filter)
+	}
+	value, err := strconv.Unquote(`"` + m[2] + `"`)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid filter value %q", m[2])
+	}
+	return m[1], value, nil
+}
+
+func baseURL(r *http.Request, appID uint64) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s%s/%d", scheme, r.Host, PathPrefix, appID)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// version 资源内容的弱 ETag
+func version(resource any) string {
+	data, _ := json.Marshal(resource)
+	return etagOf(data)
+}
+
+func etagOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// writeJSON 写出 SCIM 响应并处理 ETag/If-None-Match，etag 为空时按响应体计算
+func writeJSON(w http.ResponseWriter, r *http.Request, body any, etag string) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		log.Printf("Failed to marshal SCIM response: %v", err)
+		writeError(w, http.StatusInternalServerError, "", "internal error")
+		return
+	}
+	if etag == "" {
+		etag = etagOf(data)
+	}
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// etagMatches 弱比较 If-None-Match 中的 ETag 列表
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, scimType, detail string) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Error{
+		Schemas:  []string{errorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
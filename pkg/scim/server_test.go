@@ -0,0 +1,152 @@
+package scim
+
+import (
+	"center/model"
+	"center/pkg/config"
+	"center/pkg/db"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+// setupDB 应用 10 授权给用户 1、2，用户 3 只有映射
+func setupDB(t *testing.T) {
+	t.Helper()
+	state := openTestDB(t, "state.db")
+	m, err := db.NewStateMigrator(state, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.MigrateState(context.Background(), state, m, 0); err != nil {
+		t.Fatal(err)
+	}
+	jos := openTestDB(t, "jos.db")
+	for _, stmt := range []string{
+		"CREATE TABLE xjr_user (id integer PRIMARY KEY, user_name varchar(25), name varchar(20), delete_mark integer DEFAULT 0, enabled_mark integer DEFAULT 1)",
+		"INSERT INTO xjr_user (id, user_name) VALUES (1, 'alice'), (2, 'bob'), (3, 'carol')",
+	} {
+		if err := jos.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := jos.AutoMigrate(&model.JosApp{}, &model.JosUserApp{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := jos.Create(&model.JosApp{AppID: 10, AppName: "crm"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := jos.Create([]model.JosUserApp{{UserID: 1, AppID: 10}, {UserID: 2, AppID: 10}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Create(&model.ProxyUserApp{UserID: 3, UserName: "carol", AppID: 10}).Error; err != nil {
+		t.Fatal(err)
+	}
+	orig := db.DB
+	db.DB = db.Database{JosDb: jos, StateDb: state}
+	t.Cleanup(func() { db.DB = orig })
+}
+
+func get(t *testing.T, h http.Handler, target string, body any) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK && body != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code
+}
+
+func TestGroupMembers(t *testing.T) {
+	setupDB(t)
+	h := Handler(config.SCIMServerConfig{BearerToken: "token", MaxResults: 100, MaxGroupMembers: 3})
+
+	var group Group
+	if code := get(t, h, PathPrefix+"/10/Groups/10", &group); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if len(group.Members) != 3 || group.Members[2].Display != "carol" {
+		t.Errorf("members = %+v, want the granted and the mapped users", group.Members)
+	}
+
+	var list ListResponse
+	if code := get(t, h, PathPrefix+"/10/Users?startIndex=2&count=1", &list); code != http.StatusOK || list.TotalResults != 3 || list.ItemsPerPage != 1 {
+		t.Errorf("users page = %d, %+v", code, list)
+	}
+
+	// 成员超出上限时需排除成员查询
+	small := Handler(config.SCIMServerConfig{BearerToken: "token", MaxResults: 100, MaxGroupMembers: 2})
+	if code := get(t, small, PathPrefix+"/10/Groups/10", nil); code != http.StatusBadRequest {
+		t.Errorf("status of a group over the member limit = %d, want 400", code)
+	}
+	group = Group{}
+	if code := get(t, small, PathPrefix+"/10/Groups/10?excludedAttributes=members", &group); code != http.StatusOK || group.DisplayName != "crm" || group.Members != nil {
+		t.Errorf("group without members = %d, %+v", code, group)
+	}
+}
+
+func TestGroupScansMappingsOnce(t *testing.T) {
+	setupDB(t)
+	h := Handler(config.SCIMServerConfig{BearerToken: "token", MaxResults: 100, MaxGroupMembers: 3})
+	var scans int
+	if err := db.DB.StateDb.Callback().Query().After("gorm:query").Register("test:count", func(tx *gorm.DB) {
+		if tx.Statement.Table == "proxy_user_app" {
+			scans++
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var group Group
+	if code := get(t, h, PathPrefix+"/10/Groups/10", &group); code != http.StatusOK || len(group.Members) != 3 {
+		t.Fatalf("group = %d, %+v", code, group)
+	}
+	if scans != 1 {
+		t.Errorf("group request scanned the mappings %d times, want once", scans)
+	}
+}
+
+func TestUsersFilter(t *testing.T) {
+	setupDB(t)
+	h := Handler(config.SCIMServerConfig{BearerToken: "token", MaxResults: 100, MaxGroupMembers: 3})
+
+	var list ListResponse
+	if code := get(t, h, PathPrefix+`/10/Users?filter=userName+eq+"bob"`, &list); code != http.StatusOK || list.TotalResults != 1 {
+		t.Errorf("filtered users = %d, %+v", code, list)
+	}
+	for _, query := range []string{
+		`filter=`,
+		`filter=userName+sw+"b"`,
+		`filter=name+eq+"bob"`,
+		`filter=userName+eq+"bob"+and+active+eq+true`,
+		`filter=userName+eq+"bob"&filter=userName+eq+"alice"`,
+	} {
+		req := httptest.NewRequest(http.MethodGet, PathPrefix+"/10/Users?"+query, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		var body Error
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		if rec.Code != http.StatusBadRequest || body.ScimType != "invalidFilter" {
+			t.Errorf("%s: status = %d, scimType = %q, want 400 invalidFilter", query, rec.Code, body.ScimType)
+		}
+	}
+}
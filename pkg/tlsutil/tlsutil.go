@@ -0,0 +1,161 @@
+package tlsutil
+
+import (
+	"center/pkg/config"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval 默认检查证书文件变化的间隔
+const DefaultReloadInterval = 30 * time.Second
+
+// Configured reports whether cfg changes the default TLS settings.
+func Configured(cfg config.TLSConfig) bool {
+	return cfg.CAFile != "" || cfg.CertFile != "" || cfg.MinVersion != "" || cfg.ServerName != ""
+}
+
+// Load builds the client TLS configuration, reading the CA bundle and client
+// certificate from their files.
+func Load(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{ServerName: cfg.ServerName}
+	if cfg.MinVersion != "" {
+		version, ok := config.TLSVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q", cfg.MinVersion)
+		}
+		tlsCfg.MinVersion = version
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// NewTransport returns a transport created by newBase with the TLS settings
+// of cfg applied. The transport is rebuilt when the CA or certificate files
+// change; requests keep using the previous one if the new files fail to load.
+func NewTransport(cfg config.TLSConfig, newBase func() *http.Transport) (http.RoundTripper, error) {
+	if !Configured(cfg) {
+		return newBase(), nil
+	}
+	t := &reloadingTransport{cfg: cfg, newBase: newBase}
+	if cfg.ReloadInterval <= 0 {
+		t.cfg.ReloadInterval = DefaultReloadInterval
+	}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// fileState 证书文件的修改时间和大小，用于判断文件是否变化
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// reloadingTransport 证书文件变化后重建的 Transport
+type reloadingTransport struct {
+	cfg     config.TLSConfig
+	newBase func() *http.Transport
+
+	mu        sync.Mutex
+	current   *http.Transport
+	files     map[string]fileState
+	checkedAt time.Time
+}
+
+func (t *reloadingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	if time.Since(t.checkedAt) >= t.cfg.ReloadInterval {
+		t.checkedAt = time.Now()
+		if t.changed() {
+			if err := t.reloadLocked(); err != nil {
+				log.Printf("Failed to reload TLS certificates, keeping the previous ones: %v", err)
+			} else {
+				log.Printf("Reloaded TLS certificates (%s, %s)", t.cfg.CAFile, t.cfg.CertFile)
+			}
+		}
+	}
+	current := t.current
+	t.mu.Unlock()
+	return current.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the current transport.
+func (t *reloadingTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current.CloseIdleConnections()
+}
+
+func (t *reloadingTransport) reload() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checkedAt = time.Now()
+	return t.reloadLocked()
+}
+
+// reloadLocked 重新读取证书并替换 Transport，旧 Transport 的空闲连接被关闭
+func (t *reloadingTransport) reloadLocked() error {
+	files := t.stat()
+	tlsCfg, err := Load(t.cfg)
+	if err != nil {
+		return err
+	}
+	transport := t.newBase()
+	transport.TLSClientConfig = tlsCfg
+	if t.current != nil {
+		t.current.CloseIdleConnections()
+	}
+	t.current, t.files = transport, files
+	return nil
+}
+
+// changed 证书文件与上次加载时是否不同
+func (t *reloadingTransport) changed() bool {
+	files := t.stat()
+	if len(files) != len(t.files) {
+		return true
+	}
+	for name, state := range files {
+		if t.files[name] != state {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *reloadingTransport) stat() map[string]fileState {
+	files := make(map[string]fileState)
+	for _, name := range []string{t.cfg.CAFile, t.cfg.CertFile, t.cfg.KeyFile} {
+		if name == "" {
+			continue
+		}
+		if info, err := os.Stat(name); err == nil {
+			files[name] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return files
+}
@@ -0,0 +1,136 @@
+package tlsutil
+
+import (
+	"center/pkg/config"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCert 生成自签名的客户端证书，写入 certFile 和 keyFile
+func writeClientCert(t *testing.T, cn, certFile, keyFile string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransportMTLSReload(t *testing.T) {
+	dir := t.TempDir()
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	clients := x509.NewCertPool()
+	clients.AddCert(writeClientCert(t, "first", certFile, keyFile))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clients}
+	server.StartTLS()
+	defer server.Close()
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	transport, err := NewTransport(config.TLSConfig{
+		CAFile: caFile, CertFile: certFile, KeyFile: keyFile, MinVersion: "1.2", ReloadInterval: time.Nanosecond,
+	}, func() *http.Transport { return &http.Transport{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+	call := func() string {
+		t.Helper()
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+	if got := call(); got != "first" {
+		t.Errorf("client certificate = %q, want first", got)
+	}
+
+	// 证书轮换后使用新证书，证书名长度不同，文件大小随之变化
+	clients.AddCert(writeClientCert(t, "second", certFile, keyFile))
+	if got := call(); got != "second" {
+		t.Errorf("client certificate after rotation = %q, want second", got)
+	}
+
+	// 新证书无法加载时沿用之前的证书
+	writePEM(t, keyFile, "EC PRIVATE KEY", []byte("broken"))
+	if got := call(); got != "second" {
+		t.Errorf("client certificate after a broken rotation = %q, want second", got)
+	}
+}
+
+func TestNewTransportDefaults(t *testing.T) {
+	base := &http.Transport{}
+	transport, err := NewTransport(config.TLSConfig{}, func() *http.Transport { return base })
+	if err != nil || transport != base {
+		t.Errorf("NewTransport() without TLS settings = %v, %v, want the base transport", transport, err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(bad, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, cfg := range []config.TLSConfig{
+		{MinVersion: "0.9"},
+		{CAFile: bad},
+		{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+		{CertFile: bad, KeyFile: bad},
+	} {
+		if _, err := NewTransport(cfg, func() *http.Transport { return &http.Transport{} }); err == nil {
+			t.Errorf("NewTransport(%+v) succeeded", cfg)
+		}
+	}
+}